@@ -8,6 +8,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
 func main() {
@@ -24,6 +28,19 @@ func main() {
 	registry := agent.NewRegistry()
 
 	gsAgent := agent.NewGhostscriptAgent(ghostscriptPath, outputDir)
+	gsAgent.ProfileDir = os.Getenv("GS_ICC_PROFILE_DIR")
+	gsAgent.FontDir = os.Getenv("GS_FONT_DIR")
+	gsAgent.ImageDir = os.Getenv("GS_WATERMARK_DIR")
+
+	// Persistent interpreters are opt in, jobs may only touch the configured directories
+	if poolSize := envInt("GS_POOL_SIZE", 0); poolSize > 0 {
+		readDirs := filepath.SplitList(os.Getenv("GS_POOL_READ_DIRS"))
+		readDirs = append(readDirs, gsAgent.ProfileDir)
+		gsAgent.Pool = agent.NewGhostscriptPool(ghostscriptPath, poolSize, envInt("GS_POOL_MAX_JOBS", 100), readDirs, []string{outputDir})
+	}
+
+	// Requests share the processing slots, queuing in arrival order once they are taken
+	gsAgent.Limiter = agent.NewConcurrencyLimiter(envInt("GS_MAX_CONCURRENCY", runtime.NumCPU()), envInt("GS_MAX_REQUEST_CONCURRENCY", 0))
 	registry.Register("ghostscript", gsAgent)
 
 	svc := service.NewFileHandlerService(registry)
@@ -40,3 +57,16 @@ func main() {
 	log.Printf("Starting server on : %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
+
+// envInt read a whole number from the environment, def when unset
+func envInt(name string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return value
+}
@@ -1,10 +1,11 @@
 module file-handler-agent
 
-go 1.23
+go 1.23.0
 
 require (
 	github.com/go-kit/kit v0.13.0
 	github.com/gorilla/mux v1.8.1
+	golang.org/x/image v0.25.0
 )
 
 require (
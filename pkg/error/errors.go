@@ -17,6 +17,10 @@ var (
 	ErrUnsupportedFormat = errors.New("unsupported format")
 	ErrDirectoryCreation = errors.New("directory creation failed")
 	ErrProcessTimeout    = errors.New("process timed out")
+	ErrNotConformant     = errors.New("document cannot be made conformant")
+	ErrPasswordRequired  = errors.New("password required")
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrFontSubstitution  = errors.New("font substitution")
 )
 
 // FormatError represents an error with a specific format
@@ -43,6 +47,32 @@ func NewUnsupportedFormatError(format string) error {
 	}
 }
 
+// ParameterError represents an invalid request parameter
+type ParameterError struct {
+	Name   string
+	Reason string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *ParameterError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Err.Error(), e.Name, e.Reason)
+}
+
+// Unwrap returns the wrapped error
+func (e *ParameterError) Unwrap() error {
+	return e.Err
+}
+
+// NewInvalidParameterError creates a new parameter error
+func NewInvalidParameterError(name, reason string) error {
+	return &ParameterError{
+		Name:   name,
+		Reason: reason,
+		Err:    ErrInvalidParameter,
+	}
+}
+
 // WithMessage additional message return together
 func WithMessage(err error, message string) error {
 	return fmt.Errorf("%s: %w", message, err)
@@ -66,3 +96,32 @@ func GetFormatFromError(err error) (string, bool) {
 	}
 	return "", false
 }
+
+// IsInvalidParameter checks if the error is an invalid parameter error
+func IsInvalidParameter(err error) bool {
+	return errors.Is(err, ErrInvalidParameter)
+}
+
+// GetParameterFromError extracts the parameter name from a ParameterError if present
+func GetParameterFromError(err error) (string, bool) {
+	var paramErr *ParameterError
+	if errors.As(err, &paramErr) {
+		return paramErr.Name, true
+	}
+	return "", false
+}
+
+// IsNotConformant checks if the error is a conformance conversion failure
+func IsNotConformant(err error) bool {
+	return errors.Is(err, ErrNotConformant)
+}
+
+// IsPasswordError checks if the error is a missing or wrong document password
+func IsPasswordError(err error) bool {
+	return errors.Is(err, ErrPasswordRequired) || errors.Is(err, ErrInvalidPassword)
+}
+
+// IsFontSubstitution checks if the error is a strict mode font substitution failure
+func IsFontSubstitution(err error) bool {
+	return errors.Is(err, ErrFontSubstitution)
+}
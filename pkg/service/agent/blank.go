@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Resolution blank pages are detected at, separator pages need no detail
+const defaultBlankResolution = 30
+
+// Blank page detection methods and their default thresholds
+const (
+	blankMethodCoverage = "coverage" // summed C, M, Y and K coverage in percent
+	blankMethodVariance = "variance" // standard deviation of the gray levels, 0 to 255
+)
+
+var defaultBlankThresholds = map[string]float64{
+	blankMethodCoverage: 0.5,
+	blankMethodVariance: 6,
+}
+
+// BlankPageReport pages of one document found blank, and the cleaned pdf when they were removed
+type BlankPageReport struct {
+	File       string    `json:"file"`
+	OutputFile string    `json:"output_file,omitempty"`
+	PageCount  int       `json:"page_count"`
+	BlankPages []int     `json:"blank_pages"`
+	Scores     []float64 `json:"scores"` // score of every page, in page order
+}
+
+// blankOptions how blank pages are detected and what happens to them
+type blankOptions struct {
+	method     string
+	threshold  float64
+	resolution int
+	remove     bool
+}
+
+// parseBlankOptions read method, threshold, resolution and mode
+func parseBlankOptions(params map[string]interface{}) (*blankOptions, error) {
+	opts := &blankOptions{method: blankMethodCoverage, remove: true}
+
+	if method, _ := params["method"].(string); method != "" {
+		if _, ok := defaultBlankThresholds[method]; !ok {
+			return nil, apperrors.NewInvalidParameterError("method", "must be coverage or variance")
+		}
+		opts.method = method
+	}
+
+	opts.threshold = defaultBlankThresholds[opts.method]
+	if raw, ok := params["threshold"]; ok && raw != nil {
+		// Pages scoring below the threshold are blank, so 0 would never match
+		threshold, ok := raw.(float64)
+		if !ok || threshold <= 0 {
+			return nil, apperrors.NewInvalidParameterError("threshold", "must be a positive number")
+		}
+		opts.threshold = threshold
+	}
+
+	resolution, err := inkResolutionParam(params, defaultBlankResolution)
+	if err != nil {
+		return nil, err
+	}
+	opts.resolution = resolution
+
+	switch mode, _ := params["mode"].(string); mode {
+	case "", "remove":
+	case "report":
+		opts.remove = false
+	default:
+		return nil, apperrors.NewInvalidParameterError("mode", "must be remove or report")
+	}
+
+	return opts, nil
+}
+
+// pageScores score every page of file, blank pages score below the threshold
+func (g *GhostscriptAgent) pageScores(ctx context.Context, params map[string]interface{}, opts *blankOptions, file, workDir string, pageCount int) ([]float64, error) {
+	pages := make([]int, pageCount)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+
+	scores := make([]float64, pageCount)
+	if opts.method == blankMethodCoverage {
+		coverage, err := g.inkCoverage(ctx, params, file, pages, pageCount, opts.resolution, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i, page := range coverage {
+			scores[i] = math.Round((page.Cyan+page.Magenta+page.Yellow+page.Black)*1000) / 1000
+		}
+		return scores, nil
+	}
+
+	outputPattern := filepath.Join(workDir, "blank-%d.png")
+	args := []string{
+		"-q",
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		"-sDEVICE=pnggray",
+		fmt.Sprintf("-r%d", opts.resolution),
+		fmt.Sprintf("-sOutputFile=%s", outputPattern),
+	}
+	args = append(args, inputFileArgs(params, file)...)
+
+	if _, err := g.runGhostscript(ctx, args); err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		pageFile := fmt.Sprintf(outputPattern, i+1)
+		score, err := grayDeviation(pageFile)
+		os.Remove(pageFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to score page %d of %s: %v", i+1, file, err)
+		}
+		scores[i] = math.Round(score*1000) / 1000
+	}
+	return scores, nil
+}
+
+// grayDeviation standard deviation of the gray levels of an image, a uniform page scores 0
+// however light or dark its background
+func grayDeviation(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+
+	bounds := img.Bounds()
+	n := float64(bounds.Dx() * bounds.Dy())
+	if n == 0 {
+		return 0, nil
+	}
+	var sum, sumSquares float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			sum += v
+			sumSquares += v * v
+		}
+	}
+	mean := sum / n
+	return math.Sqrt(math.Max(sumSquares/n-mean*mean, 0)), nil
+}
+
+// blankPages pages whose score falls below the threshold
+func blankPages(scores []float64, threshold float64) []int {
+	pages := []int{}
+	for i, score := range scores {
+		if score < threshold {
+			pages = append(pages, i+1)
+		}
+	}
+	return pages
+}
+
+// keptPages pages of the document that are not blank
+func keptPages(pageCount int, blank []int) []int {
+	isBlank := make(map[int]bool, len(blank))
+	for _, page := range blank {
+		isBlank[page] = true
+	}
+	var pages []int
+	for page := 1; page <= pageCount; page++ {
+		if !isBlank[page] {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// removeBlankPages find pages with next to no content and report them or write the pdfs without them
+func (g *GhostscriptAgent) removeBlankPages(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting blank page detection for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	opts, err := parseBlankOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]interface{}, len(files))
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		scores, err := g.pageScores(ctx, params, opts, file, fileOutputDir, pageCount)
+		if err != nil {
+			return nil, err
+		}
+
+		report := BlankPageReport{
+			File:       file,
+			PageCount:  pageCount,
+			BlankPages: blankPages(scores, opts.threshold),
+			Scores:     scores,
+		}
+		reports[fileIdx] = &report
+		if !opts.remove {
+			return nil, nil
+		}
+
+		kept := keptPages(pageCount, report.BlankPages)
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("%s: every page is blank", file)
+		}
+
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+		args := append(pdfwriteArgs(outputFile), colorArgs...)
+		args = append(args, fmt.Sprintf("-sPageList=%s", formatPageList(kept)))
+		args = append(args, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+		report.OutputFile = outputFile
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	setMetadata(params, reports)
+
+	log.Printf("Completed blank page detection for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBlankOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        map[string]interface{}
+		expected      *blankOptions
+		expectedError bool
+	}{
+		{
+			name:     "Defaults",
+			params:   map[string]interface{}{},
+			expected: &blankOptions{method: blankMethodCoverage, threshold: 0.5, resolution: 30, remove: true},
+		},
+		{
+			name:     "Variance report",
+			params:   map[string]interface{}{"method": "variance", "mode": "report", "resolution": float64(50)},
+			expected: &blankOptions{method: blankMethodVariance, threshold: 6, resolution: 50},
+		},
+		{
+			name:     "Explicit threshold",
+			params:   map[string]interface{}{"threshold": 1.5},
+			expected: &blankOptions{method: blankMethodCoverage, threshold: 1.5, resolution: 30, remove: true},
+		},
+		{name: "Unknown method", params: map[string]interface{}{"method": "ocr"}, expectedError: true},
+		{name: "Negative threshold", params: map[string]interface{}{"threshold": -1.0}, expectedError: true},
+		{name: "Zero threshold", params: map[string]interface{}{"threshold": 0.0}, expectedError: true},
+		{name: "Unknown mode", params: map[string]interface{}{"mode": "delete"}, expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseBlankOptions(tc.params)
+			if tc.expectedError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected an invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts, tc.expected) {
+				t.Errorf("Expected options %+v, got %+v", tc.expected, opts)
+			}
+		})
+	}
+}
+
+func TestGrayDeviation(t *testing.T) {
+	dir := t.TempDir()
+
+	// A uniform gray scan background scores 0, a page with half its pixels black scores half the range
+	flat := image.NewGray(image.Rect(0, 0, 10, 10))
+	marked := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i := range flat.Pix {
+		flat.Pix[i] = 230
+		marked.Pix[i] = 255
+		if i%2 == 0 {
+			marked.Pix[i] = 0
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		img      image.Image
+		expected float64
+	}{
+		{name: "Uniform", img: flat, expected: 0},
+		{name: "Half black", img: marked, expected: 127.5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".png")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := png.Encode(f, tc.img); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			score, err := grayDeviation(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if score != tc.expected {
+				t.Errorf("Expected score %v, got %v", tc.expected, score)
+			}
+		})
+	}
+}
+
+func TestBlankAndKeptPages(t *testing.T) {
+	blank := blankPages([]float64{12.4, 0.1, 3.2, 0, 0.49}, 0.5)
+	if expected := []int{2, 4, 5}; !reflect.DeepEqual(blank, expected) {
+		t.Errorf("Expected blank pages %v, got %v", expected, blank)
+	}
+	if kept := keptPages(5, blank); !reflect.DeepEqual(kept, []int{1, 3}) {
+		t.Errorf("Expected kept pages [1 3], got %v", kept)
+	}
+	if blank := blankPages([]float64{1, 2}, 0.5); blank == nil || len(blank) != 0 {
+		t.Errorf("Expected an empty list, got %v", blank)
+	}
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"sort"
+)
+
+// Capabilities formats the agent reads and writes and the ICC profiles it can color manage with
+type Capabilities struct {
+	InputFormats []string     `json:"input_formats"`
+	ImageFormats []string     `json:"image_formats"`
+	ICCProfiles  []ICCProfile `json:"icc_profiles"`
+}
+
+// capabilities report what this agent supports, the request needs no input files
+func (g *GhostscriptAgent) capabilities(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	profiles, err := g.iccProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	setMetadata(params, []interface{}{Capabilities{
+		InputFormats: formatNames(supportedInputFormats, imageInputFormats),
+		ImageFormats: formatNames(supportedOutputFormats),
+		ICCProfiles:  profiles,
+	}})
+
+	return []string{}, nil
+}
+
+// formatNames merge format sets into a sorted list
+func formatNames(sets ...map[string]bool) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, set := range sets {
+		for name := range set {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
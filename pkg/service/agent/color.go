@@ -0,0 +1,227 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ICC profile file extensions looked up in the profile directory
+var iccProfileExts = map[string]bool{
+	".icc": true,
+	".icm": true,
+}
+
+// Rendering intents and their ghostscript -dRenderIntent values
+var renderingIntents = map[string]int{
+	"perceptual":   0,
+	"colorimetric": 1,
+	"saturation":   2,
+	"absolute":     3,
+}
+
+// Default source profile parameters, the color space they must hold and the ghostscript switch they set
+var sourceProfileParams = []struct {
+	param      string
+	colorSpace string
+	switchName string
+}{
+	{param: "rgb_profile", colorSpace: "RGB", switchName: "DefaultRGBProfile"},
+	{param: "cmyk_profile", colorSpace: "CMYK", switchName: "DefaultCMYKProfile"},
+	{param: "gray_profile", colorSpace: "Gray", switchName: "DefaultGrayProfile"},
+}
+
+// ICCProfile profile available in the configured profile directory
+type ICCProfile struct {
+	Name       string `json:"name"`
+	ColorSpace string `json:"color_space"`
+}
+
+// colorOptions ICC color management requested for a conversion
+type colorOptions struct {
+	sourceProfiles map[string]string // ghostscript switch to profile path
+	outputProfile  string
+	outputSpace    string // RGB, CMYK or Gray
+	intent         int    // -1 keeps the ghostscript default
+	blackPoint     bool
+}
+
+// parseColorOptions read the profile, rendering intent and black point compensation parameters
+func (g *GhostscriptAgent) parseColorOptions(params map[string]interface{}) (*colorOptions, error) {
+	opts := &colorOptions{sourceProfiles: make(map[string]string), intent: -1}
+
+	for _, source := range sourceProfileParams {
+		name, _ := params[source.param].(string)
+		if name == "" {
+			continue
+		}
+		path, colorSpace, err := g.resolveProfile(source.param, name)
+		if err != nil {
+			return nil, err
+		}
+		if colorSpace != source.colorSpace {
+			return nil, apperrors.NewInvalidParameterError(source.param, fmt.Sprintf("%s is a %s profile", name, colorSpace))
+		}
+		opts.sourceProfiles[source.switchName] = path
+	}
+
+	if name, _ := params["output_profile"].(string); name != "" {
+		path, colorSpace, err := g.resolveProfile("output_profile", name)
+		if err != nil {
+			return nil, err
+		}
+		opts.outputProfile, opts.outputSpace = path, colorSpace
+	}
+
+	if intent, _ := params["rendering_intent"].(string); intent != "" {
+		value, ok := renderingIntents[strings.ToLower(intent)]
+		if !ok {
+			return nil, apperrors.NewInvalidParameterError("rendering_intent",
+				"must be perceptual, colorimetric, saturation or absolute")
+		}
+		opts.intent = value
+	}
+
+	opts.blackPoint, _ = params["black_point_compensation"].(bool)
+
+	return opts, nil
+}
+
+// resolveProfile find a profile by name in the profile directory, returning its path and color space
+func (g *GhostscriptAgent) resolveProfile(param, name string) (string, string, error) {
+	if g.ProfileDir == "" {
+		return "", "", apperrors.NewInvalidParameterError(param, "no ICC profile directory is configured")
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", "", apperrors.NewInvalidParameterError(param, "must be the name of a profile in the profile directory")
+	}
+
+	// The extension may be left out
+	candidates := []string{name}
+	if !iccProfileExts[strings.ToLower(filepath.Ext(name))] {
+		candidates = []string{name + ".icc", name + ".icm"}
+	}
+	for _, candidate := range candidates {
+		path := filepath.Join(g.ProfileDir, candidate)
+		if !fileExists(path) {
+			continue
+		}
+		colorSpace, err := profileColorSpace(path)
+		if err != nil {
+			return "", "", apperrors.NewInvalidParameterError(param, err.Error())
+		}
+		return path, colorSpace, nil
+	}
+	return "", "", apperrors.NewInvalidParameterError(param, fmt.Sprintf("unknown ICC profile %q", name))
+}
+
+// profileColorSpace read the ColorConversionStrategy name of a profile's color space
+func profileColorSpace(path string) (string, error) {
+	signature, err := readICCColorSpace(path)
+	if err != nil {
+		return "", err
+	}
+	space, ok := iccColorSpaces[signature]
+	if !ok {
+		return "", fmt.Errorf("unsupported profile color space %q", signature)
+	}
+	return space.strategy, nil
+}
+
+// sourceArgs ghostscript switches for the default source profiles, rendering intent and black point compensation
+func (c colorOptions) sourceArgs() []string {
+	var args []string
+	for _, source := range sourceProfileParams {
+		if path, ok := c.sourceProfiles[source.switchName]; ok {
+			args = append(args,
+				fmt.Sprintf("-s%s=%s", source.switchName, path),
+				fmt.Sprintf("--permit-file-read=%s", path),
+			)
+		}
+	}
+	if c.intent >= 0 {
+		args = append(args, fmt.Sprintf("-dRenderIntent=%d", c.intent))
+	}
+	if c.blackPoint {
+		args = append(args, "-dBlackPtComp=1")
+	}
+	return args
+}
+
+// rasterArgs ghostscript switches for a raster device producing colorSpace pixels
+func (c colorOptions) rasterArgs(colorSpace string) ([]string, error) {
+	args := c.sourceArgs()
+	if c.outputProfile != "" {
+		if c.outputSpace != colorSpace {
+			return nil, apperrors.NewInvalidParameterError("output_profile",
+				fmt.Sprintf("a %s profile cannot describe %s output", c.outputSpace, colorSpace))
+		}
+		args = append(args,
+			fmt.Sprintf("-sOutputICCProfile=%s", c.outputProfile),
+			fmt.Sprintf("--permit-file-read=%s", c.outputProfile),
+		)
+	}
+	return args, nil
+}
+
+// pdfArgs ghostscript switches for pdfwrite, an output profile also converts the colors into its space
+func (c colorOptions) pdfArgs() []string {
+	args := c.sourceArgs()
+	if c.outputProfile != "" {
+		args = append(args,
+			fmt.Sprintf("-sColorConversionStrategy=%s", c.outputSpace),
+			fmt.Sprintf("-sOutputICCProfile=%s", c.outputProfile),
+			fmt.Sprintf("--permit-file-read=%s", c.outputProfile),
+		)
+	}
+	return args
+}
+
+// pdfColorArgs parse the color parameters of a pdf writing action into pdfwrite switches
+func (g *GhostscriptAgent) pdfColorArgs(params map[string]interface{}) ([]string, error) {
+	color, err := g.parseColorOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	return color.pdfArgs(), nil
+}
+
+// colorModeSpace color space of the pixels written in a color mode
+func colorModeSpace(colorMode string) string {
+	switch colorMode {
+	case "cmyk":
+		return "CMYK"
+	case "gray", "mono":
+		return "Gray"
+	}
+	return "RGB"
+}
+
+// iccProfiles list the usable profiles in the profile directory, by name
+func (g *GhostscriptAgent) iccProfiles() ([]ICCProfile, error) {
+	if g.ProfileDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(g.ProfileDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ICC profile directory: %v", err)
+	}
+
+	var profiles []ICCProfile
+	for _, entry := range entries {
+		if entry.IsDir() || !iccProfileExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		// Profiles ghostscript could not use are left out
+		colorSpace, err := profileColorSpace(filepath.Join(g.ProfileDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, ICCProfile{Name: entry.Name(), ColorSpace: colorSpace})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
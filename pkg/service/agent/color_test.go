@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeICCProfile write a file holding just an ICC profile header for the given color space signature
+func writeICCProfile(t *testing.T, path, signature string) {
+	t.Helper()
+	header := make([]byte, 128)
+	copy(header[16:20], signature)
+	copy(header[36:40], "acsp")
+	if err := os.WriteFile(path, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newProfileAgent(t *testing.T) *GhostscriptAgent {
+	dir := t.TempDir()
+	writeICCProfile(t, filepath.Join(dir, "sRGB.icc"), "RGB ")
+	writeICCProfile(t, filepath.Join(dir, "FOGRA39.icc"), "CMYK")
+	writeICCProfile(t, filepath.Join(dir, "gray.icm"), "GRAY")
+	writeICCProfile(t, filepath.Join(dir, "lab.icc"), "Lab ")
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a profile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &GhostscriptAgent{ProfileDir: dir}
+}
+
+func TestParseColorOptions(t *testing.T) {
+	g := newProfileAgent(t)
+
+	testCases := []struct {
+		name          string
+		params        map[string]interface{}
+		expectedArgs  []string
+		expectedError string
+	}{
+		{name: "No color management", params: map[string]interface{}{}},
+		{
+			name: "Source profiles and intent",
+			params: map[string]interface{}{
+				"cmyk_profile":             "FOGRA39",
+				"gray_profile":             "gray.icm",
+				"rendering_intent":         "colorimetric",
+				"black_point_compensation": true,
+			},
+			expectedArgs: []string{
+				"-sDefaultCMYKProfile=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+				"--permit-file-read=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+				"-sDefaultGrayProfile=" + filepath.Join(g.ProfileDir, "gray.icm"),
+				"--permit-file-read=" + filepath.Join(g.ProfileDir, "gray.icm"),
+				"-dRenderIntent=1",
+				"-dBlackPtComp=1",
+			},
+		},
+		{
+			name:   "Output profile converts pdf colors",
+			params: map[string]interface{}{"output_profile": "FOGRA39.icc"},
+			expectedArgs: []string{
+				"-sColorConversionStrategy=CMYK",
+				"-sOutputICCProfile=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+				"--permit-file-read=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+			},
+		},
+		{name: "Wrong profile space", params: map[string]interface{}{"rgb_profile": "FOGRA39"}, expectedError: "rgb_profile"},
+		{name: "Unsupported profile space", params: map[string]interface{}{"output_profile": "lab"}, expectedError: "output_profile"},
+		{name: "Unknown profile", params: map[string]interface{}{"rgb_profile": "AdobeRGB"}, expectedError: "rgb_profile"},
+		{name: "Path outside the directory", params: map[string]interface{}{"rgb_profile": "../sRGB.icc"}, expectedError: "rgb_profile"},
+		{name: "Unknown intent", params: map[string]interface{}{"rendering_intent": "vivid"}, expectedError: "rendering_intent"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := g.pdfColorArgs(tc.params)
+			if tc.expectedError != "" {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Fatalf("Expected invalid %s, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Errorf("Expected args %v, got %v", tc.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestColorOptionsRasterArgs(t *testing.T) {
+	g := newProfileAgent(t)
+	opts, err := g.parseColorOptions(map[string]interface{}{"output_profile": "FOGRA39"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := opts.rasterArgs(colorModeSpace("color")); !apperrors.IsInvalidParameter(err) {
+		t.Errorf("Expected a CMYK profile to be refused for RGB output, got %v", err)
+	}
+	args, err := opts.rasterArgs(colorModeSpace("cmyk"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"-sOutputICCProfile=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+		"--permit-file-read=" + filepath.Join(g.ProfileDir, "FOGRA39.icc"),
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, args)
+	}
+}
+
+func TestICCProfiles(t *testing.T) {
+	g := newProfileAgent(t)
+	expected := []ICCProfile{
+		{Name: "FOGRA39.icc", ColorSpace: "CMYK"},
+		{Name: "gray.icm", ColorSpace: "Gray"},
+		{Name: "sRGB.icc", ColorSpace: "RGB"},
+	}
+	profiles, err := g.iccProfiles()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("Expected profiles %v, got %v", expected, profiles)
+	}
+
+	if _, err := (&GhostscriptAgent{}).parseColorOptions(map[string]interface{}{"rgb_profile": "sRGB"}); !apperrors.IsInvalidParameter(err) {
+		t.Errorf("Expected profiles to be refused without a profile directory, got %v", err)
+	}
+}
+
+func TestPdfWriteActionsColorParams(t *testing.T) {
+	g := newProfileAgent(t)
+	g.BinaryPath = "gs-not-run"
+	input := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := writeBlankPdf(input, 612, 792); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		action string
+		params map[string]interface{}
+	}{
+		{action: "mergePdf", params: map[string]interface{}{}},
+		{action: "splitPdf", params: map[string]interface{}{}},
+		{action: "protectPdf", params: map[string]interface{}{"owner_password": "owner"}},
+		{action: "watermarkPdf", params: map[string]interface{}{"watermark_text": "DRAFT"}},
+		{action: "nupPdf", params: map[string]interface{}{}},
+		{action: "updatePdfMetadata", params: map[string]interface{}{"strip": true}},
+		{action: "removeBlankPages", params: map[string]interface{}{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.action, func(t *testing.T) {
+			// Refused before ghostscript runs, rather than ignored
+			tc.params["output_dir"] = t.TempDir()
+			tc.params["output_profile"] = "missing"
+			_, err := g.Execute(context.Background(), tc.action, tc.params, []string{input})
+			if !apperrors.IsInvalidParameter(err) {
+				t.Errorf("Expected invalid parameter error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Supported -dPDFSETTINGS presets
+var supportedCompressionPresets = map[string]bool{
+	"screen":   true,
+	"ebook":    true,
+	"printer":  true,
+	"prepress": true,
+	"default":  true,
+}
+
+// CompressionInfo size report for one compressed file
+type CompressionInfo struct {
+	File           string `json:"file"`
+	OutputFile     string `json:"output_file"`
+	OriginalSize   int64  `json:"original_size"`
+	CompressedSize int64  `json:"compressed_size"`
+	// CompressionRatio original size divided by compressed size
+	CompressionRatio float64 `json:"compression_ratio"`
+}
+
+// compressPdf rewrite the input pdfs with pdfwrite using a quality preset
+func (g *GhostscriptAgent) compressPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF compression for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	args, distillerParams, err := compressionArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, colorArgs...)
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]interface{}, len(files))
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		fileArgs := append(pdfwriteArgs(outputFile), args...)
+		if distillerParams != "" {
+			fileArgs = append(fileArgs, "-c", distillerParams, "-f")
+		}
+		fileArgs = append(fileArgs, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, fileArgs); err != nil {
+			return nil, err
+		}
+
+		report, err := compressionReport(file, outputFile)
+		if err != nil {
+			return nil, err
+		}
+		reports[fileIdx] = report
+
+		log.Printf("Compressed %s from %d to %d bytes (ratio %.2f)",
+			file, report.OriginalSize, report.CompressedSize, report.CompressionRatio)
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	setMetadata(params, reports)
+
+	log.Printf("Completed PDF compression for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// compressionArgs pdfwrite switches for preset, image_resolution and jpeg_quality,
+// and the distiller parameters to run right before the input file
+func compressionArgs(params map[string]interface{}) ([]string, string, error) {
+	preset, _ := params["preset"].(string)
+	if preset == "" {
+		preset = "ebook"
+	}
+	if !supportedCompressionPresets[preset] {
+		return nil, "", apperrors.NewInvalidParameterError("preset", fmt.Sprintf("unsupported preset %q", preset))
+	}
+
+	args := []string{
+		fmt.Sprintf("-dPDFSETTINGS=/%s", preset),
+		"-dCompatibilityLevel=1.5",
+	}
+
+	// Explicit image downsampling overrides the preset
+	if imageResolution, ok := params["image_resolution"].(float64); ok {
+		if imageResolution < 1 || imageResolution > 2400 {
+			return nil, "", apperrors.NewInvalidParameterError("image_resolution", "must be between 1 and 2400")
+		}
+		args = append(args,
+			"-dDownsampleColorImages=true",
+			"-dDownsampleGrayImages=true",
+			"-dDownsampleMonoImages=true",
+			fmt.Sprintf("-dColorImageResolution=%d", int(imageResolution)),
+			fmt.Sprintf("-dGrayImageResolution=%d", int(imageResolution)),
+			fmt.Sprintf("-dMonoImageResolution=%d", int(imageResolution)),
+		)
+	}
+
+	// Distiller parameters have to follow the switches, right before the input file
+	var distillerParams string
+	if jpegQuality, ok := params["jpeg_quality"].(float64); ok {
+		if jpegQuality < 1 || jpegQuality > 100 {
+			return nil, "", apperrors.NewInvalidParameterError("jpeg_quality", "must be between 1 and 100")
+		}
+		qFactor := jpegQualityToQFactor(int(jpegQuality))
+		args = append(args,
+			"-dAutoFilterColorImages=false",
+			"-dAutoFilterGrayImages=false",
+			"-dColorImageFilter=/DCTEncode",
+			"-dGrayImageFilter=/DCTEncode",
+		)
+		distillerParams = fmt.Sprintf(
+			"<< /ColorImageDict << /QFactor %.2f /Blend 1 /HSamples [2 1 1 2] /VSamples [2 1 1 2] >> "+
+				"/GrayImageDict << /QFactor %.2f /Blend 1 /HSamples [2 1 1 2] /VSamples [2 1 1 2] >> >> setdistillerparams",
+			qFactor, qFactor)
+	}
+	return args, distillerParams, nil
+}
+
+// compressionReport compare the sizes of an input file and its compressed output
+func compressionReport(inputFile, outputFile string) (CompressionInfo, error) {
+	inputInfo, err := os.Stat(inputFile)
+	if err != nil {
+		return CompressionInfo{}, err
+	}
+	outputInfo, err := os.Stat(outputFile)
+	if err != nil {
+		return CompressionInfo{}, err
+	}
+
+	report := CompressionInfo{
+		File:           inputFile,
+		OutputFile:     outputFile,
+		OriginalSize:   inputInfo.Size(),
+		CompressedSize: outputInfo.Size(),
+	}
+	if report.CompressedSize > 0 {
+		report.CompressionRatio = float64(report.OriginalSize) / float64(report.CompressedSize)
+	}
+	return report, nil
+}
+
+// jpegQualityToQFactor convert a 1-100 JPEG quality into a distiller QFactor,
+// using the IJG quality scaling that QFactor follows closely
+func jpegQualityToQFactor(quality int) float64 {
+	if quality < 50 {
+		return 50 / float64(quality)
+	}
+	return max(float64(200-2*quality)/100, 0.05)
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompressionArgs(t *testing.T) {
+	testCases := []struct {
+		name              string
+		params            map[string]interface{}
+		expectedArgs      []string
+		expectedDistiller string // substring of the distiller parameters, empty when there are none
+		expectError       bool
+	}{
+		{
+			name:         "Default preset",
+			params:       map[string]interface{}{},
+			expectedArgs: []string{"-dPDFSETTINGS=/ebook", "-dCompatibilityLevel=1.5"},
+		},
+		{
+			name:         "Screen preset",
+			params:       map[string]interface{}{"preset": "screen"},
+			expectedArgs: []string{"-dPDFSETTINGS=/screen", "-dCompatibilityLevel=1.5"},
+		},
+		{
+			name:         "Prepress preset",
+			params:       map[string]interface{}{"preset": "prepress"},
+			expectedArgs: []string{"-dPDFSETTINGS=/prepress", "-dCompatibilityLevel=1.5"},
+		},
+		{
+			name:   "Image resolution",
+			params: map[string]interface{}{"preset": "printer", "image_resolution": 150.0},
+			expectedArgs: []string{"-dPDFSETTINGS=/printer", "-dCompatibilityLevel=1.5",
+				"-dDownsampleColorImages=true", "-dDownsampleGrayImages=true", "-dDownsampleMonoImages=true",
+				"-dColorImageResolution=150", "-dGrayImageResolution=150", "-dMonoImageResolution=150"},
+		},
+		{
+			name:   "High JPEG quality",
+			params: map[string]interface{}{"jpeg_quality": 90.0},
+			expectedArgs: []string{"-dPDFSETTINGS=/ebook", "-dCompatibilityLevel=1.5",
+				"-dAutoFilterColorImages=false", "-dAutoFilterGrayImages=false",
+				"-dColorImageFilter=/DCTEncode", "-dGrayImageFilter=/DCTEncode"},
+			expectedDistiller: "/ColorImageDict << /QFactor 0.20 ",
+		},
+		{
+			name:   "Low JPEG quality",
+			params: map[string]interface{}{"jpeg_quality": 25.0},
+			expectedArgs: []string{"-dPDFSETTINGS=/ebook", "-dCompatibilityLevel=1.5",
+				"-dAutoFilterColorImages=false", "-dAutoFilterGrayImages=false",
+				"-dColorImageFilter=/DCTEncode", "-dGrayImageFilter=/DCTEncode"},
+			expectedDistiller: "/GrayImageDict << /QFactor 2.00 ",
+		},
+		{name: "Unknown preset", params: map[string]interface{}{"preset": "tiny"}, expectError: true},
+		{name: "Preset with a slash", params: map[string]interface{}{"preset": "/screen"}, expectError: true},
+		{name: "Image resolution out of range", params: map[string]interface{}{"image_resolution": 0.0}, expectError: true},
+		{name: "JPEG quality out of range", params: map[string]interface{}{"jpeg_quality": 101.0}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, distillerParams, err := compressionArgs(tc.params)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Errorf("Expected args %v, got %v", tc.expectedArgs, args)
+			}
+			if tc.expectedDistiller == "" && distillerParams != "" {
+				t.Errorf("Expected no distiller parameters, got %q", distillerParams)
+			}
+			if !strings.Contains(distillerParams, tc.expectedDistiller) {
+				t.Errorf("Expected distiller parameters containing %q, got %q", tc.expectedDistiller, distillerParams)
+			}
+		})
+	}
+}
+
+func TestJPEGQualityToQFactor(t *testing.T) {
+	testCases := []struct {
+		quality  int
+		expected float64
+	}{
+		{quality: 1, expected: 50},
+		{quality: 25, expected: 2},
+		{quality: 50, expected: 1},
+		{quality: 75, expected: 0.5},
+		{quality: 100, expected: 0.05},
+	}
+
+	for _, tc := range testCases {
+		if got := jpegQualityToQFactor(tc.quality); math.Abs(got-tc.expected) > 1e-9 {
+			t.Errorf("Expected QFactor %v for quality %d, got %v", tc.expected, tc.quality, got)
+		}
+	}
+}
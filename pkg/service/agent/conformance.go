@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// conformanceLevel archival or print standard a pdf can be converted to
+type conformanceLevel struct {
+	pdfa int  // PDF/A part, 0 for PDF/X
+	pdfx bool // PDF/X-3
+}
+
+// Supported conformance levels
+var supportedConformanceLevels = map[string]conformanceLevel{
+	"pdfa-1b": {pdfa: 1},
+	"pdfa-2b": {pdfa: 2},
+	"pdfa-3b": {pdfa: 3},
+	"pdfx-3":  {pdfx: true},
+}
+
+// iccColorSpaces color space signatures in an ICC profile header and the
+// matching ColorConversionStrategy and component count
+var iccColorSpaces = map[string]struct {
+	strategy   string
+	components int
+}{
+	"RGB ": {strategy: "RGB", components: 3},
+	"CMYK": {strategy: "CMYK", components: 4},
+	"GRAY": {strategy: "Gray", components: 1},
+}
+
+// convertPdfConformance convert the input pdfs to PDF/A or PDF/X
+func (g *GhostscriptAgent) convertPdfConformance(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF conformance conversion for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	conformance, _ := params["conformance"].(string)
+	if conformance == "" {
+		conformance = "pdfa-2b"
+	}
+	level, ok := supportedConformanceLevels[strings.ToLower(conformance)]
+	if !ok {
+		return nil, apperrors.NewInvalidParameterError("conformance", fmt.Sprintf("unsupported conformance level %q", conformance))
+	}
+
+	color, err := g.parseColorOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// The output intent needs an ICC profile matching the output color space,
+	// picked from the profile directory as icc_profile or output_profile
+	iccProfile := color.outputProfile
+	if name, _ := params["icc_profile"].(string); name != "" {
+		if iccProfile != "" {
+			return nil, apperrors.NewInvalidParameterError("output_profile", "cannot be combined with icc_profile")
+		}
+		if iccProfile, _, err = g.resolveProfile("icc_profile", name); err != nil {
+			return nil, err
+		}
+	}
+	if iccProfile == "" {
+		return nil, apperrors.NewInvalidParameterError("icc_profile", "an output intent ICC profile is required")
+	}
+	colorSpace, err := readICCColorSpace(iccProfile)
+	if err != nil {
+		return nil, apperrors.NewInvalidParameterError("icc_profile", err.Error())
+	}
+	space, ok := iccColorSpaces[colorSpace]
+	if !ok {
+		return nil, apperrors.NewInvalidParameterError("icc_profile", fmt.Sprintf("unsupported profile color space %q", colorSpace))
+	}
+	if level.pdfx && space.strategy != "CMYK" {
+		return nil, apperrors.NewInvalidParameterError("icc_profile", "PDF/X-3 requires a CMYK profile")
+	}
+
+	outputCondition, _ := params["output_condition"].(string)
+	if outputCondition == "" {
+		outputCondition = strings.TrimSuffix(filepath.Base(iccProfile), filepath.Ext(iccProfile))
+	}
+
+	args := []string{
+		fmt.Sprintf("-sColorConversionStrategy=%s", space.strategy),
+		fmt.Sprintf("-sOutputICCProfile=%s", iccProfile),
+		fmt.Sprintf("--permit-file-read=%s", iccProfile),
+	}
+	args = append(args, color.sourceArgs()...)
+	args = append(args, level.args()...)
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		// The output intent is set up by a definitions file run before the document
+		defFile := filepath.Join(fileOutputDir, baseNameWithoutExt+"_def.ps")
+		def := conformanceDefinitions(level, iccProfile, space.components, outputCondition)
+		if err := os.WriteFile(defFile, []byte(def), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write conformance definitions for %s: %v", file, err)
+		}
+		defer os.Remove(defFile)
+
+		fileArgs := append(pdfwriteArgs(outputFile), args...)
+		fileArgs = append(fileArgs, defFile)
+		fileArgs = append(fileArgs, inputFileArgs(params, file)...)
+
+		output, err := g.runGhostscript(ctx, fileArgs)
+		if err != nil {
+			os.Remove(outputFile)
+			return nil, conformanceError(file, output, err)
+		}
+		if !fileExists(outputFile) {
+			return nil, fmt.Errorf("%s: %w", file, apperrors.ErrNotConformant)
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed %s conversion for %d files in %v", conformance, len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// args pdfwrite switches producing the level, with the pdf version it requires
+func (l conformanceLevel) args() []string {
+	if l.pdfx {
+		return []string{"-dPDFX", "-dCompatibilityLevel=1.3"}
+	}
+
+	compatibility := "1.7"
+	if l.pdfa == 1 {
+		compatibility = "1.4"
+	}
+	// Abort instead of silently writing a non-conforming file
+	return []string{
+		fmt.Sprintf("-dPDFA=%d", l.pdfa),
+		"-dPDFACompatibilityPolicy=2",
+		fmt.Sprintf("-dCompatibilityLevel=%s", compatibility),
+	}
+}
+
+// readICCColorSpace read the data color space signature from an ICC profile header
+func readICCColorSpace(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open ICC profile: %v", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, 40)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return "", fmt.Errorf("invalid ICC profile: %v", err)
+	}
+	if string(header[36:40]) != "acsp" {
+		return "", fmt.Errorf("invalid ICC profile: missing signature")
+	}
+	return string(header[16:20]), nil
+}
+
+// conformanceDefinitions PostScript run ahead of the document to embed the output intent
+func conformanceDefinitions(level conformanceLevel, iccProfile string, components int, outputCondition string) string {
+	subtype := "/GTS_PDFA1"
+	var b strings.Builder
+	b.WriteString("%!\n")
+	if level.pdfx {
+		subtype = "/GTS_PDFX"
+		b.WriteString("[ /GTS_PDFXVersion (PDF/X-3:2002) /Trapped /False /DOCINFO pdfmark\n")
+	}
+	fmt.Fprintf(&b, "/ICCProfile %s def\n", psString(iccProfile))
+	b.WriteString("[/_objdef {icc_intent} /type /stream /OBJ pdfmark\n")
+	fmt.Fprintf(&b, "[{icc_intent} << /N %d >> /PUT pdfmark\n", components)
+	b.WriteString("[{icc_intent} ICCProfile (r) file /PUT pdfmark\n")
+	b.WriteString("[/_objdef {OutputIntent} /type /dict /OBJ pdfmark\n")
+	fmt.Fprintf(&b, "[{OutputIntent} << /Type /OutputIntent /S %s /DestOutputProfile {icc_intent} "+
+		"/OutputCondition %s /OutputConditionIdentifier %s >> /PUT pdfmark\n",
+		subtype, psString(outputCondition), psString(outputCondition))
+	b.WriteString("[{Catalog} << /OutputIntents [ {OutputIntent} ] >> /PUT pdfmark\n")
+	return b.String()
+}
+
+// conformanceError report a failed conversion as ErrNotConformant when ghostscript complained about conformance
+func conformanceError(file string, output []byte, err error) error {
+	if reason := conformanceFailure(output); reason != "" {
+		return fmt.Errorf("%s: %w: %s", file, apperrors.ErrNotConformant, reason)
+	}
+	return err
+}
+
+// conformanceFailure pick the PDF/A or PDF/X complaints out of ghostscript output
+func conformanceFailure(output []byte) string {
+	var reasons []string
+	for _, line := range strings.Split(string(output), "\n") {
+		upper := strings.ToUpper(line)
+		if strings.Contains(upper, "PDFA") || strings.Contains(upper, "PDF/A") ||
+			strings.Contains(upper, "PDFX") || strings.Contains(upper, "PDF/X") {
+			reasons = append(reasons, strings.TrimSpace(line))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	apperrors "file-handler-agent/pkg/error"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertPdfConformanceProfile(t *testing.T) {
+	g := newProfileAgent(t)
+	input := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := writeBlankPdf(input, 612, 792); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		params map[string]interface{}
+	}{
+		{name: "No profile", params: map[string]interface{}{}},
+		{name: "Server path", params: map[string]interface{}{"icc_profile": "/etc/passwd"}},
+		{name: "Path escaping the profile directory", params: map[string]interface{}{"icc_profile": "../sRGB.icc"}},
+		{name: "Unknown profile", params: map[string]interface{}{"icc_profile": "missing"}},
+		{name: "Both profile parameters", params: map[string]interface{}{"icc_profile": "sRGB", "output_profile": "FOGRA39"}},
+		{name: "PDF/X with an RGB profile", params: map[string]interface{}{"conformance": "pdfx-3", "icc_profile": "sRGB"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.params["output_dir"] = t.TempDir()
+			_, err := g.convertPdfConformance(context.Background(), tc.params, []string{input})
+			if !apperrors.IsInvalidParameter(err) {
+				t.Errorf("Expected invalid parameter error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestConformanceLevelArgs(t *testing.T) {
+	testCases := []struct {
+		conformance string
+		expected    []string
+	}{
+		{conformance: "pdfa-1b", expected: []string{"-dPDFA=1", "-dPDFACompatibilityPolicy=2", "-dCompatibilityLevel=1.4"}},
+		{conformance: "pdfa-2b", expected: []string{"-dPDFA=2", "-dPDFACompatibilityPolicy=2", "-dCompatibilityLevel=1.7"}},
+		{conformance: "pdfa-3b", expected: []string{"-dPDFA=3", "-dPDFACompatibilityPolicy=2", "-dCompatibilityLevel=1.7"}},
+		{conformance: "pdfx-3", expected: []string{"-dPDFX", "-dCompatibilityLevel=1.3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.conformance, func(t *testing.T) {
+			level, ok := supportedConformanceLevels[tc.conformance]
+			if !ok {
+				t.Fatalf("Expected %s to be supported", tc.conformance)
+			}
+			if args := level.args(); !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("Expected args %v, got %v", tc.expected, args)
+			}
+		})
+	}
+}
+
+func TestConformanceDefinitions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		level       conformanceLevel
+		components  int
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:        "PDF/A",
+			level:       conformanceLevel{pdfa: 2},
+			components:  3,
+			contains:    []string{"/ICCProfile (/profiles/sRGB.icc) def", "<< /N 3 >>", "/S /GTS_PDFA1", "/OutputCondition (sRGB)"},
+			notContains: []string{"GTS_PDFXVersion"},
+		},
+		{
+			name:       "PDF/X",
+			level:      conformanceLevel{pdfx: true},
+			components: 4,
+			contains:   []string{"/GTS_PDFXVersion (PDF/X-3:2002)", "<< /N 4 >>", "/S /GTS_PDFX", "/OutputConditionIdentifier (sRGB)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := conformanceDefinitions(tc.level, "/profiles/sRGB.icc", tc.components, "sRGB")
+			for _, s := range tc.contains {
+				if !strings.Contains(def, s) {
+					t.Errorf("Expected definitions to contain %q, got:\n%s", s, def)
+				}
+			}
+			for _, s := range tc.notContains {
+				if strings.Contains(def, s) {
+					t.Errorf("Expected definitions not to contain %q, got:\n%s", s, def)
+				}
+			}
+		})
+	}
+}
+
+func TestConformanceError(t *testing.T) {
+	runErr := errors.New("ghostscript error: exit status 1")
+
+	testCases := []struct {
+		name           string
+		output         string
+		expectedReason string
+	}{
+		{
+			name: "PDF/A policy abort",
+			output: "GPL Ghostscript 10.02.1 (2023-11-01)\n" +
+				"Processing pages 1 through 1.\n" +
+				" Transparency is not permitted in PDF/A-1, aborting conversion.\n" +
+				"\n   **** ERROR: Aborting conversion due to PDFA compatibility policy.\n",
+			expectedReason: "Transparency is not permitted in PDF/A-1, aborting conversion.; **** ERROR: Aborting conversion due to PDFA compatibility policy.",
+		},
+		{
+			name:           "PDF/X complaint",
+			output:         "Setting Overprint Mode to 1 not permitted in PDF/X-3, overprint mode not set\n",
+			expectedReason: "Setting Overprint Mode to 1 not permitted in PDF/X-3, overprint mode not set",
+		},
+		{name: "Unrelated failure", output: "Error: /undefinedfilename in (in.pdf)\n"},
+		{name: "No output"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := conformanceError("in.pdf", []byte(tc.output), runErr)
+			if tc.expectedReason == "" {
+				if err != runErr {
+					t.Errorf("Expected the ghostscript error to pass through, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, apperrors.ErrNotConformant) {
+				t.Fatalf("Expected ErrNotConformant, got %v", err)
+			}
+			if expected := "in.pdf: " + apperrors.ErrNotConformant.Error() + ": " + tc.expectedReason; err.Error() != expected {
+				t.Errorf("Expected %q, got %q", expected, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Devices that support -dDownScaleFactor
+var downScaleDevices = map[string]bool{
+	"png16m":   true,
+	"pnggray":  true,
+	"pngmono":  true,
+	"tiff24nc": true,
+	"tiff32nc": true,
+	"tiffgray": true,
+	"tiffg4":   true,
+}
+
+// Devices whose output can be recompressed, 1-bit png would be widened to 8-bit on re-encoding
+var recompressibleDevices = map[string]bool{
+	"png16m":   true,
+	"pnggray":  true,
+	"pngalpha": true,
+}
+
+// encodingOptions output encoding and rendering quality settings of raster devices
+type encodingOptions struct {
+	jpegQuality       int // 0 keeps the device default
+	pngCompression    int // -1 keeps the encoding ghostscript wrote
+	downScaleFactor   int
+	textAlphaBits     int // 0 leaves anti-aliasing off
+	graphicsAlphaBits int
+}
+
+// parseEncodingOptions read and validate the encoding parameters for device
+func parseEncodingOptions(params map[string]interface{}, device string, antiAliasing bool) (encodingOptions, error) {
+	opts := encodingOptions{
+		pngCompression:  -1,
+		downScaleFactor: 1,
+	}
+	if antiAliasing {
+		opts.textAlphaBits = 4
+		opts.graphicsAlphaBits = 4
+	}
+
+	if quality, ok, err := wholeNumberParam(params, "jpeg_quality"); err != nil {
+		return opts, err
+	} else if ok {
+		if !strings.HasPrefix(device, "jpeg") {
+			return opts, apperrors.NewInvalidParameterError("jpeg_quality", "only supported for jpeg output")
+		}
+		if quality < 1 || quality > 100 {
+			return opts, apperrors.NewInvalidParameterError("jpeg_quality", "must be between 1 and 100")
+		}
+		opts.jpegQuality = quality
+	}
+
+	if level, ok, err := wholeNumberParam(params, "png_compression"); err != nil {
+		return opts, err
+	} else if ok {
+		if !recompressibleDevices[device] {
+			return opts, apperrors.NewInvalidParameterError("png_compression",
+				fmt.Sprintf("not supported for device %s", device))
+		}
+		if level < 0 || level > 9 {
+			return opts, apperrors.NewInvalidParameterError("png_compression", "must be between 0 and 9")
+		}
+		opts.pngCompression = level
+	}
+
+	if factor, ok, err := wholeNumberParam(params, "downscale_factor"); err != nil {
+		return opts, err
+	} else if ok {
+		if factor < 1 || factor > 8 {
+			return opts, apperrors.NewInvalidParameterError("downscale_factor", "must be between 1 and 8")
+		}
+		if factor > 1 && !downScaleDevices[device] {
+			return opts, apperrors.NewInvalidParameterError("downscale_factor",
+				fmt.Sprintf("not supported for device %s", device))
+		}
+		opts.downScaleFactor = factor
+	}
+
+	for _, alpha := range []struct {
+		name   string
+		target *int
+	}{
+		{name: "text_alpha_bits", target: &opts.textAlphaBits},
+		{name: "graphics_alpha_bits", target: &opts.graphicsAlphaBits},
+	} {
+		bits, ok, err := wholeNumberParam(params, alpha.name)
+		if err != nil {
+			return opts, err
+		}
+		if !ok {
+			continue
+		}
+		if bits != 1 && bits != 2 && bits != 4 {
+			return opts, apperrors.NewInvalidParameterError(alpha.name, "must be 1, 2 or 4")
+		}
+		*alpha.target = bits
+	}
+
+	return opts, nil
+}
+
+// args ghostscript arguments rendering at xres by yres dpi with these options
+func (o encodingOptions) args(xres, yres float64) []string {
+	// Supersample so the downscaled output still has the requested resolution
+	factor := float64(o.downScaleFactor)
+	resolution := strconv.FormatFloat(xres*factor, 'f', -1, 64)
+	if xres != yres {
+		resolution += "x" + strconv.FormatFloat(yres*factor, 'f', -1, 64)
+	}
+
+	args := []string{"-r" + resolution}
+	if o.downScaleFactor > 1 {
+		args = append(args, fmt.Sprintf("-dDownScaleFactor=%d", o.downScaleFactor))
+	}
+	if o.jpegQuality > 0 {
+		args = append(args, fmt.Sprintf("-dJPEGQ=%d", o.jpegQuality))
+	}
+	if o.textAlphaBits > 0 {
+		args = append(args, fmt.Sprintf("-dTextAlphaBits=%d", o.textAlphaBits))
+	}
+	if o.graphicsAlphaBits > 0 {
+		args = append(args, fmt.Sprintf("-dGraphicsAlphaBits=%d", o.graphicsAlphaBits))
+	}
+	return args
+}
+
+// recompressPNGs re-encode png files with the requested zlib compression level
+func recompressPNGs(files []string, level int) error {
+	encoder := png.Encoder{CompressionLevel: pngCompressionLevel(level)}
+	for _, file := range files {
+		if err := recompressPNG(file, encoder); err != nil {
+			return fmt.Errorf("failed to recompress %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// recompressPNG re-encode a single png in place
+func recompressPNG(file string, encoder png.Encoder) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+
+	tmpFile := file + ".tmp"
+	out, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(out, img); err != nil {
+		out.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// pngCompressionLevel map a zlib style 0-9 level onto the levels the png encoder offers
+func pngCompressionLevel(level int) png.CompressionLevel {
+	switch {
+	case level == 0:
+		return png.NoCompression
+	case level <= 3:
+		return png.BestSpeed
+	case level <= 6:
+		return png.DefaultCompression
+	default:
+		return png.BestCompression
+	}
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"reflect"
+	"testing"
+)
+
+func TestParseEncodingOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        map[string]interface{}
+		device        string
+		antiAliasing  bool
+		expectedArgs  []string
+		expectedParam string
+	}{
+		{
+			name:         "Defaults",
+			params:       map[string]interface{}{},
+			device:       "png16m",
+			expectedArgs: []string{"-r150"},
+		},
+		{
+			name:         "Anti aliasing keeps the old alpha bits",
+			params:       map[string]interface{}{},
+			device:       "png16m",
+			antiAliasing: true,
+			expectedArgs: []string{"-r150", "-dTextAlphaBits=4", "-dGraphicsAlphaBits=4"},
+		},
+		{
+			name:         "Explicit alpha bits and downscale",
+			params:       map[string]interface{}{"text_alpha_bits": 2.0, "downscale_factor": 3.0},
+			device:       "pnggray",
+			expectedArgs: []string{"-r450", "-dDownScaleFactor=3", "-dTextAlphaBits=2"},
+		},
+		{
+			name:         "Jpeg quality",
+			params:       map[string]interface{}{"jpeg_quality": 85.0},
+			device:       "jpeg",
+			expectedArgs: []string{"-r150", "-dJPEGQ=85"},
+		},
+		{
+			name:          "Jpeg quality out of range",
+			params:        map[string]interface{}{"jpeg_quality": 101.0},
+			device:        "jpeg",
+			expectedParam: "jpeg_quality",
+		},
+		{
+			name:          "Jpeg quality on png",
+			params:        map[string]interface{}{"jpeg_quality": 80.0},
+			device:        "png16m",
+			expectedParam: "jpeg_quality",
+		},
+		{
+			name:          "Png compression out of range",
+			params:        map[string]interface{}{"png_compression": 10.0},
+			device:        "png16m",
+			expectedParam: "png_compression",
+		},
+		{
+			name:          "Downscale on jpeg",
+			params:        map[string]interface{}{"downscale_factor": 2.0},
+			device:        "jpeg",
+			expectedParam: "downscale_factor",
+		},
+		{
+			name:          "Invalid alpha bits",
+			params:        map[string]interface{}{"graphics_alpha_bits": 3.0},
+			device:        "png16m",
+			expectedParam: "graphics_alpha_bits",
+		},
+		{
+			name:          "Fractional value",
+			params:        map[string]interface{}{"downscale_factor": 1.5},
+			device:        "png16m",
+			expectedParam: "downscale_factor",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseEncodingOptions(tc.params, tc.device, tc.antiAliasing)
+			if tc.expectedParam != "" {
+				name, ok := apperrors.GetParameterFromError(err)
+				if !ok || name != tc.expectedParam || !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid %s parameter error, got %v", tc.expectedParam, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if args := opts.args(150, 150); !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Errorf("Expected args %v, got %v", tc.expectedArgs, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Ghostscript messages reporting a substituted font, the first group is the substitute and the second the requested font
+var fontSubstitutionPattern = regexp.MustCompile(`Substituting (?:CID )?font (\S+) for (\S+?)\.?$`)
+
+// Ghostscript messages reporting a font it could not find at all
+var missingFontPattern = regexp.MustCompile(`Can't find (?:CID )?font "?([^"\s]+)"?`)
+
+// psNamePattern characters allowed in a PostScript font name
+var psNamePattern = regexp.MustCompile(`^[^\s()<>\[\]{}/%]+$`)
+
+// FontSubstitution a font the document asked for that ghostscript replaced
+type FontSubstitution struct {
+	File       string `json:"file"`
+	Font       string `json:"font"`
+	Substitute string `json:"substitute,omitempty"`
+}
+
+// fontOptions where ghostscript looks for fonts the document does not embed
+type fontOptions struct {
+	paths   []string
+	fontMap map[string]string // font name to a substitute font name or font file
+	strict  bool
+}
+
+// Font file extensions a font_map target may name instead of a font
+var fontFileExts = map[string]bool{
+	".ttf": true,
+	".ttc": true,
+	".otf": true,
+	".pfa": true,
+	".pfb": true,
+	".t1":  true,
+}
+
+// parseFontOptions read font_path, font_map and font_strict. Directories and font files
+// are named relative to the configured font directory and must stay inside it.
+func (g *GhostscriptAgent) parseFontOptions(params map[string]interface{}) (*fontOptions, error) {
+	opts := &fontOptions{fontMap: make(map[string]string)}
+	opts.strict, _ = params["font_strict"].(bool)
+
+	switch raw := params["font_path"].(type) {
+	case nil:
+	case string:
+		opts.paths = []string{raw}
+	case []interface{}:
+		for _, entry := range raw {
+			path, ok := entry.(string)
+			if !ok {
+				return nil, apperrors.NewInvalidParameterError("font_path", "must be a directory or a list of directories")
+			}
+			opts.paths = append(opts.paths, path)
+		}
+	default:
+		return nil, apperrors.NewInvalidParameterError("font_path", "must be a directory or a list of directories")
+	}
+	for i, name := range opts.paths {
+		if g.FontDir == "" {
+			return nil, apperrors.NewInvalidParameterError("font_path", "no font directory is configured")
+		}
+		path, ok := resolveInDir(g.FontDir, name)
+		if info, err := os.Stat(path); !ok || err != nil || !info.IsDir() {
+			return nil, apperrors.NewInvalidParameterError("font_path", fmt.Sprintf("%s is not a directory in the font directory", name))
+		}
+		opts.paths[i] = path
+	}
+
+	if raw, ok := params["font_map"]; ok && raw != nil {
+		fontMap, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, apperrors.NewInvalidParameterError("font_map", "must map font names to fonts or font files")
+		}
+		for name, rawTarget := range fontMap {
+			target, ok := rawTarget.(string)
+			if !ok || !psNamePattern.MatchString(name) {
+				return nil, apperrors.NewInvalidParameterError("font_map", fmt.Sprintf("invalid entry for %q", name))
+			}
+			if isFontFile(target) {
+				if g.FontDir == "" {
+					return nil, apperrors.NewInvalidParameterError("font_map", "no font directory is configured")
+				}
+				path, ok := resolveInDir(g.FontDir, target)
+				if !ok || !fileExists(path) {
+					return nil, apperrors.NewInvalidParameterError("font_map", fmt.Sprintf("font file %s not found in the font directory", target))
+				}
+				target = path
+			} else if !psNamePattern.MatchString(target) {
+				return nil, apperrors.NewInvalidParameterError("font_map", fmt.Sprintf("invalid font name %q", target))
+			}
+			opts.fontMap[name] = target
+		}
+	}
+
+	return opts, nil
+}
+
+// isFontFile report whether a font map target names a file rather than a font
+func isFontFile(target string) bool {
+	return strings.ContainsAny(target, `/\`) || fontFileExts[strings.ToLower(filepath.Ext(target))]
+}
+
+// writeFontmap write the substitution map as a ghostscript Fontmap
+func (f fontOptions) writeFontmap(path string) error {
+	names := make([]string, 0, len(f.fontMap))
+	for name := range f.fontMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		target := f.fontMap[name]
+		if isFontFile(target) {
+			fmt.Fprintf(&b, "/%s %s ;\n", name, psString(target))
+		} else {
+			fmt.Fprintf(&b, "/%s /%s ;\n", name, target)
+		}
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// args ghostscript switches for the font directories and the Fontmap, empty fontmapFile when there is none
+func (f fontOptions) args(fontmapFile string) []string {
+	var args []string
+	if len(f.paths) > 0 {
+		args = append(args, fmt.Sprintf("-sFONTPATH=%s", strings.Join(f.paths, string(os.PathListSeparator))))
+		for _, path := range f.paths {
+			// A trailing separator lets SAFER read everything below the directory
+			args = append(args, fmt.Sprintf("--permit-file-read=%s%c", strings.TrimRight(path, string(os.PathSeparator)), os.PathSeparator))
+		}
+	}
+	if fontmapFile != "" {
+		args = append(args, fmt.Sprintf("-sFONTMAP=%s", fontmapFile), fmt.Sprintf("--permit-file-read=%s", fontmapFile))
+		for _, target := range f.fontMap {
+			if isFontFile(target) {
+				args = append(args, fmt.Sprintf("--permit-file-read=%s", target))
+			}
+		}
+	}
+	return args
+}
+
+// prepare write the Fontmap into dir when there is a font map, returning the switches and a cleanup
+func (f fontOptions) prepare(dir string) ([]string, func(), error) {
+	if len(f.fontMap) == 0 {
+		return f.args(""), func() {}, nil
+	}
+	fontmapFile := filepath.Join(dir, "Fontmap")
+	if err := f.writeFontmap(fontmapFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to write font map: %v", err)
+	}
+	return f.args(fontmapFile), func() { os.Remove(fontmapFile) }, nil
+}
+
+// check collect the substitutions ghostscript reported while processing file.
+// In strict mode any font not covered by the font map fails the file.
+func (f fontOptions) check(file string, output []byte) ([]FontSubstitution, error) {
+	substitutions := parseFontSubstitutions(output)
+	var unmapped []string
+	for i := range substitutions {
+		substitutions[i].File = file
+		if _, mapped := f.fontMap[substitutions[i].Font]; !mapped {
+			unmapped = append(unmapped, substitutions[i].Font)
+		}
+	}
+
+	if f.strict && len(unmapped) > 0 {
+		return substitutions, fmt.Errorf("%s: %w: %s", file, apperrors.ErrFontSubstitution, strings.Join(unmapped, ", "))
+	}
+	return substitutions, nil
+}
+
+// parseFontSubstitutions pick the substituted and missing fonts out of ghostscript output, once per font
+func parseFontSubstitutions(output []byte) []FontSubstitution {
+	var substitutions []FontSubstitution
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var substitution FontSubstitution
+		if match := fontSubstitutionPattern.FindStringSubmatch(line); match != nil {
+			substitution = FontSubstitution{Font: match[2], Substitute: match[1]}
+		} else if match := missingFontPattern.FindStringSubmatch(line); match != nil {
+			substitution = FontSubstitution{Font: match[1]}
+		} else {
+			continue
+		}
+
+		if !seen[substitution.Font] {
+			seen[substitution.Font] = true
+			substitutions = append(substitutions, substitution)
+		}
+	}
+	return substitutions
+}
+
+// fontMetadata flatten the per-file substitutions for the response metadata
+func fontMetadata(reports [][]FontSubstitution) []interface{} {
+	var entries []interface{}
+	seen := make(map[FontSubstitution]bool)
+	for _, substitutions := range reports {
+		for _, substitution := range substitutions {
+			if !seen[substitution] {
+				seen[substitution] = true
+				entries = append(entries, substitution)
+			}
+		}
+	}
+	return entries
+}
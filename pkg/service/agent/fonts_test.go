@@ -0,0 +1,112 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const substitutionOutput = `Page 1
+Querying operating system for font files...
+Didn't find this font on the system!
+Substituting font Helvetica for ArialMT.
+Loading NimbusSans-Regular font from /usr/share/ghostscript/fonts/n019003l.pfb... 4419972 2834458 1 done.
+Page 2
+Substituting font Helvetica for ArialMT.
+Can't find CID font "MSGothic".
+Substituting font Times-Roman for Garamond.
+`
+
+func TestParseFontSubstitutions(t *testing.T) {
+	expected := []FontSubstitution{
+		{Font: "ArialMT", Substitute: "Helvetica"},
+		{Font: "MSGothic"},
+		{Font: "Garamond", Substitute: "Times-Roman"},
+	}
+	if got := parseFontSubstitutions([]byte(substitutionOutput)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected substitutions %v, got %v", expected, got)
+	}
+}
+
+func TestFontOptionsCheck(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        fontOptions
+		expectError bool
+	}{
+		{name: "Lenient", opts: fontOptions{}},
+		{name: "Strict", opts: fontOptions{strict: true}, expectError: true},
+		{name: "Strict with every font mapped", opts: fontOptions{strict: true, fontMap: map[string]string{
+			"ArialMT": "LiberationSans", "MSGothic": "IPAGothic", "Garamond": "EBGaramond",
+		}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			substitutions, err := tc.opts.check("doc.pdf", []byte(substitutionOutput))
+			if len(substitutions) != 3 || substitutions[0].File != "doc.pdf" {
+				t.Errorf("Unexpected substitutions %v", substitutions)
+			}
+			if tc.expectError != apperrors.IsFontSubstitution(err) {
+				t.Errorf("Expected font substitution error %v, got %v", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestParseFontOptions(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "Corporate.ttf")
+	os.WriteFile(fontFile, []byte("font"), 0644)
+	os.Mkdir(filepath.Join(dir, "extra"), 0755)
+	g := &GhostscriptAgent{FontDir: dir}
+
+	opts, err := g.parseFontOptions(map[string]interface{}{
+		"font_path": []interface{}{"extra"},
+		"font_map":  map[string]interface{}{"Arial": "LiberationSans", "CorporateSans": "Corporate.ttf"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root, _ := filepath.EvalSymlinks(dir)
+	if expected := []string{filepath.Join(root, "extra")}; !reflect.DeepEqual(opts.paths, expected) {
+		t.Errorf("Expected font path %v, got %v", expected, opts.paths)
+	}
+
+	fontmapFile := filepath.Join(dir, "Fontmap")
+	if err := opts.writeFontmap(fontmapFile); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(fontmapFile)
+	expected := "/Arial /LiberationSans ;\n/CorporateSans (" + filepath.Join(root, "Corporate.ttf") + ") ;\n"
+	if string(content) != expected {
+		t.Errorf("Expected Fontmap %q, got %q", expected, content)
+	}
+
+	// Paths leading out of the font directory are refused, symlinks included
+	os.Symlink("/", filepath.Join(dir, "root"))
+	testCases := []struct {
+		name   string
+		agent  *GhostscriptAgent
+		params map[string]interface{}
+	}{
+		{name: "Missing directory", agent: g, params: map[string]interface{}{"font_path": "missing"}},
+		{name: "Absolute directory", agent: g, params: map[string]interface{}{"font_path": "/"}},
+		{name: "Parent directory", agent: g, params: map[string]interface{}{"font_path": ".."}},
+		{name: "Symlink out of the directory", agent: g, params: map[string]interface{}{"font_path": "root"}},
+		{name: "Missing font file", agent: g, params: map[string]interface{}{"font_map": map[string]interface{}{"Arial": "missing.ttf"}}},
+		{name: "Font file outside", agent: g, params: map[string]interface{}{"font_map": map[string]interface{}{"Arial": "/etc/passwd"}}},
+		{name: "Font file through a symlink", agent: g, params: map[string]interface{}{"font_map": map[string]interface{}{"Arial": "root/etc/passwd"}}},
+		{name: "Invalid font name", agent: g, params: map[string]interface{}{"font_map": map[string]interface{}{"Bad Name": "Helvetica"}}},
+		{name: "No font directory", agent: &GhostscriptAgent{}, params: map[string]interface{}{"font_path": "extra"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.agent.parseFontOptions(tc.params); !apperrors.IsInvalidParameter(err) {
+				t.Errorf("Expected invalid parameter error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paper sizes accepted by resizePdf, in points
+var paperSizes = map[string][2]float64{
+	"a3":     {842, 1191},
+	"a4":     {595, 842},
+	"a5":     {420, 595},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// Page boxes cropPdf can crop to, and the switch making ghostscript use them
+var cropBoxSwitches = map[string]string{
+	"cropbox":  "-dUseCropBox",
+	"trimbox":  "-dUseTrimBox",
+	"bleedbox": "-dUseBleedBox",
+	"artbox":   "-dUseArtBox",
+}
+
+// pageFileArgsFunc extra pdfwrite arguments for one input file
+type pageFileArgsFunc func(file string) ([]string, error)
+
+// rewriteEachPdf write every input pdf through pdfwrite with per-file extra arguments
+func (g *GhostscriptAgent) rewriteEachPdf(ctx context.Context, params map[string]interface{}, files []string, fileArgs pageFileArgsFunc) ([]string, error) {
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		extraArgs, err := fileArgs(file)
+		if err != nil {
+			return nil, err
+		}
+
+		args := append(pdfwriteArgs(outputFile), colorArgs...)
+		args = append(args, extraArgs...)
+		args = append(args, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+		return []string{outputFile}, nil
+	})
+}
+
+// endPagePdfmarkArgs arguments issuing a /PAGE pdfmark with the given value for each zero based page index
+func endPagePdfmarkArgs(key string, values map[int]string) []string {
+	entries := make([]string, 0, len(values))
+	for idx, value := range values {
+		entries = append(entries, fmt.Sprintf("%d %s", idx, value))
+	}
+
+	program := fmt.Sprintf("/FHAPageValues << %s >> def "+
+		"<< /EndPage { exch 1 index 2 lt { dup FHAPageValues exch known "+
+		"{ FHAPageValues exch get [ /%s 3 -1 roll /PAGE pdfmark } { pop } ifelse } { pop } ifelse 2 ne } bind >> setpagedevice",
+		strings.Join(entries, " "), key)
+
+	return []string{"-c", program, "-f"}
+}
+
+// rotatePdf rotate selected pages by a multiple of 90 degrees
+func (g *GhostscriptAgent) rotatePdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF rotation for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	angle, _, err := wholeNumberParam(params, "angle")
+	if err != nil {
+		return nil, err
+	}
+	if angle != 90 && angle != 180 && angle != 270 {
+		return nil, apperrors.NewInvalidParameterError("angle", "must be 90, 180 or 270")
+	}
+
+	pages, _ := params["pages"].(string)
+	if pages == "" {
+		pages = "all"
+	}
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.rewriteEachPdf(ctx, params, files, func(file string) ([]string, error) {
+		// The new rotation is absolute, so it builds on what each page already has
+		info, err := g.inspectFile(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		selectedPages, err := selection.resolve(info.PageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		current := make(map[int]int, len(info.Pages))
+		for _, page := range info.Pages {
+			current[page.Number] = page.Rotate
+		}
+
+		rotations := make(map[int]string, len(selectedPages))
+		for _, page := range selectedPages {
+			rotations[page-1] = strconv.Itoa((current[page] + angle) % 360)
+		}
+
+		args := []string{"-dAutoRotatePages=/None"}
+		return append(args, endPagePdfmarkArgs("Rotate", rotations)...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF rotation for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// cropPdf crop pages to an explicit box or to one of the boxes stored in the pdf
+func (g *GhostscriptAgent) cropPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF crop for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	boxName, _ := params["box"].(string)
+	rawBox, hasCustomBox := params["crop_box"]
+	if boxName == "" && !hasCustomBox {
+		return nil, apperrors.NewInvalidParameterError("box", "box or crop_box is required")
+	}
+	if boxName != "" && hasCustomBox {
+		return nil, apperrors.NewInvalidParameterError("crop_box", "cannot be combined with box")
+	}
+
+	var fileArgs pageFileArgsFunc
+	if boxName != "" {
+		// Stored boxes apply to every page
+		boxSwitch, ok := cropBoxSwitches[strings.ToLower(boxName)]
+		if !ok {
+			return nil, apperrors.NewInvalidParameterError("box", fmt.Sprintf("unsupported box %q", boxName))
+		}
+		fileArgs = func(string) ([]string, error) {
+			return []string{boxSwitch}, nil
+		}
+	} else {
+		box, err := parseBoxParam("crop_box", rawBox)
+		if err != nil {
+			return nil, err
+		}
+
+		pages, _ := params["pages"].(string)
+		if pages == "" {
+			pages = "all"
+		}
+		selection, err := parsePageSelection(pages)
+		if err != nil {
+			return nil, err
+		}
+
+		boxValue := fmt.Sprintf("[%s %s %s %s]",
+			formatPSNumber(box[0]), formatPSNumber(box[1]), formatPSNumber(box[2]), formatPSNumber(box[3]))
+		fileArgs = func(file string) ([]string, error) {
+			pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+			if err != nil {
+				return nil, err
+			}
+			selectedPages, err := selection.resolve(pageCount)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			boxes := make(map[int]string, len(selectedPages))
+			for _, page := range selectedPages {
+				boxes[page-1] = boxValue
+			}
+			return endPagePdfmarkArgs("CropBox", boxes), nil
+		}
+	}
+
+	outputFiles, err := g.rewriteEachPdf(ctx, params, files, fileArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF crop for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// resizePdf scale every page to fit a target paper size
+func (g *GhostscriptAgent) resizePdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF resize for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	size, err := paperSizeParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		fmt.Sprintf("-dDEVICEWIDTHPOINTS=%s", formatPSNumber(size[0])),
+		fmt.Sprintf("-dDEVICEHEIGHTPOINTS=%s", formatPSNumber(size[1])),
+		"-dFIXEDMEDIA",
+		"-dPDFFitPage",
+	}
+
+	outputFiles, err := g.rewriteEachPdf(ctx, params, files, func(string) ([]string, error) {
+		return args, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF resize for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// paperSizeParam read a named paper_size or a custom page_width and page_height in points
+func paperSizeParam(params map[string]interface{}) ([2]float64, error) {
+	if name, ok := params["paper_size"].(string); ok && name != "" {
+		size, ok := paperSizes[strings.ToLower(name)]
+		if !ok {
+			return size, apperrors.NewInvalidParameterError("paper_size", fmt.Sprintf("unsupported paper size %q", name))
+		}
+		if landscape, _ := params["landscape"].(bool); landscape {
+			size[0], size[1] = size[1], size[0]
+		}
+		return size, nil
+	}
+
+	width, _ := params["page_width"].(float64)
+	height, _ := params["page_height"].(float64)
+	if width <= 0 || height <= 0 || width > 14400 || height > 14400 {
+		return [2]float64{}, apperrors.NewInvalidParameterError("paper_size",
+			"paper_size or page_width and page_height between 1 and 14400 points are required")
+	}
+	return [2]float64{width, height}, nil
+}
+
+// optionalPaperSizeParam read the paper size when one was given, nil otherwise
+func optionalPaperSizeParam(params map[string]interface{}) (*[2]float64, error) {
+	_, hasPaperSize := params["paper_size"]
+	_, hasPageWidth := params["page_width"]
+	if !hasPaperSize && !hasPageWidth {
+		return nil, nil
+	}
+	size, err := paperSizeParam(params)
+	if err != nil {
+		return nil, err
+	}
+	return &size, nil
+}
+
+// parseBoxParam parse a [llx lly urx ury] box in points
+func parseBoxParam(name string, raw interface{}) ([4]float64, error) {
+	var box [4]float64
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != 4 {
+		return box, apperrors.NewInvalidParameterError(name, "must be [llx, lly, urx, ury]")
+	}
+	for i, value := range values {
+		v, ok := value.(float64)
+		if !ok {
+			return box, apperrors.NewInvalidParameterError(name, "must contain numbers")
+		}
+		box[i] = v
+	}
+	if box[2] <= box[0] || box[3] <= box[1] {
+		return box, apperrors.NewInvalidParameterError(name, "upper right corner must lie above and right of lower left")
+	}
+	return box, nil
+}
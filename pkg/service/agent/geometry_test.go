@@ -0,0 +1,62 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"strings"
+	"testing"
+)
+
+func TestPaperSizeParam(t *testing.T) {
+	testCases := []struct {
+		name        string
+		params      map[string]interface{}
+		expected    [2]float64
+		expectError bool
+	}{
+		{name: "A4", params: map[string]interface{}{"paper_size": "A4"}, expected: [2]float64{595, 842}},
+		{name: "Landscape letter", params: map[string]interface{}{"paper_size": "letter", "landscape": true}, expected: [2]float64{792, 612}},
+		{name: "Custom", params: map[string]interface{}{"page_width": 300.0, "page_height": 400.0}, expected: [2]float64{300, 400}},
+		{name: "Unknown", params: map[string]interface{}{"paper_size": "b7"}, expectError: true},
+		{name: "Missing", params: map[string]interface{}{}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			size, err := paperSizeParam(tc.params)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if size != tc.expected {
+				t.Errorf("Expected size %v, got %v", tc.expected, size)
+			}
+		})
+	}
+}
+
+func TestParseBoxParam(t *testing.T) {
+	if _, err := parseBoxParam("crop_box", []interface{}{0.0, 0.0, 100.0, 200.0}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := parseBoxParam("crop_box", []interface{}{100.0, 0.0, 50.0, 200.0}); !apperrors.IsInvalidParameter(err) {
+		t.Errorf("Expected inverted box to be rejected, got %v", err)
+	}
+	if _, err := parseBoxParam("crop_box", []interface{}{0.0, 0.0, 100.0}); !apperrors.IsInvalidParameter(err) {
+		t.Errorf("Expected short box to be rejected, got %v", err)
+	}
+}
+
+func TestEndPagePdfmarkArgs(t *testing.T) {
+	args := endPagePdfmarkArgs("Rotate", map[int]string{2: "90"})
+	if len(args) != 3 || args[0] != "-c" || args[2] != "-f" {
+		t.Fatalf("Unexpected args %v", args)
+	}
+	if !strings.Contains(args[1], "<< 2 90 >>") || !strings.Contains(args[1], "/Rotate 3 -1 roll /PAGE pdfmark") {
+		t.Errorf("Unexpected EndPage program %q", args[1])
+	}
+}
@@ -3,11 +3,13 @@ package agent
 import (
 	"context"
 	"errors"
+	apperrors "file-handler-agent/pkg/error"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +18,13 @@ import (
 // Supported input file formats
 var supportedInputFormats = map[string]bool{
 	".pdf": true,
+	".ps":  true,
+	".eps": true,
+}
+
+// Input formats of the actions that work on pdf structure
+var pdfInputFormats = map[string]bool{
+	".pdf": true,
 }
 
 // Supported output image formats
@@ -23,12 +32,46 @@ var supportedOutputFormats = map[string]bool{
 	"jpg":  true,
 	"jpeg": true,
 	"png":  true,
+	"tif":  true,
+	"tiff": true,
+	"bmp":  true,
+}
+
+// Ghostscript raster devices by output format and color mode
+var gsDevices = map[string]map[string]string{
+	"jpeg": {
+		"color": "jpeg",
+		"gray":  "jpeggray",
+		"cmyk":  "jpegcmyk",
+	},
+	"png": {
+		"color": "png16m",
+		"gray":  "pnggray",
+		"mono":  "pngmono",
+		"alpha": "pngalpha",
+	},
+	"tiff": {
+		"color": "tiff24nc",
+		"gray":  "tiffgray",
+		"mono":  "tiffg4",
+		"cmyk":  "tiff32nc",
+	},
+	"bmp": {
+		"color": "bmp16m",
+		"gray":  "bmpgray",
+		"mono":  "bmpmono",
+	},
 }
 
 // GhostscriptAgent execute ghostscript cmd
 type GhostscriptAgent struct {
 	BinaryPath string
 	OutputDir  string
+	FontDir    string              // fonts requests may add to the font path or map, empty when none
+	ProfileDir string              // ICC profiles available to color managed conversions, empty when none
+	ImageDir   string              // images requests may stamp as watermarks, empty when none
+	Pool       *GhostscriptPool    // persistent interpreters for the jobs they can run, nil to start a process per run
+	Limiter    *ConcurrencyLimiter // bounds the files processed at once, nil for no limit
 }
 
 // NewGhostscriptAgent generate new ghostscript agent
@@ -44,6 +87,44 @@ func (g *GhostscriptAgent) Execute(ctx context.Context, action string, params ma
 	switch action {
 	case "convertPdfToImage":
 		return g.convertPdfToImage(ctx, params, files)
+	case "mergePdf":
+		return g.mergePdf(ctx, params, files)
+	case "splitPdf":
+		return g.splitPdf(ctx, params, files)
+	case "compressPdf":
+		return g.compressPdf(ctx, params, files)
+	case "convertPdfConformance":
+		return g.convertPdfConformance(ctx, params, files)
+	case "extractText":
+		return g.extractText(ctx, params, files)
+	case "inspectPdf":
+		return g.inspectPdf(ctx, params, files)
+	case "protectPdf":
+		return g.protectPdf(ctx, params, files)
+	case "watermarkPdf":
+		return g.watermarkPdf(ctx, params, files)
+	case "rotatePdf":
+		return g.rotatePdf(ctx, params, files)
+	case "cropPdf":
+		return g.cropPdf(ctx, params, files)
+	case "resizePdf":
+		return g.resizePdf(ctx, params, files)
+	case "nupPdf":
+		return g.nupPdf(ctx, params, files)
+	case "convertPsToPdf":
+		return g.convertPsToPdf(ctx, params, files)
+	case "convertImagesToPdf":
+		return g.convertImagesToPdf(ctx, params, files)
+	case "linearizePdf":
+		return g.linearizePdf(ctx, params, files)
+	case "updatePdfMetadata":
+		return g.updatePdfMetadata(ctx, params, files)
+	case "reportInkCoverage":
+		return g.reportInkCoverage(ctx, params, files)
+	case "removeBlankPages":
+		return g.removeBlankPages(ctx, params, files)
+	case "capabilities":
+		return g.capabilities(ctx, params, files)
 	default:
 		return nil, errors.New("unsupported action")
 	}
@@ -62,20 +143,9 @@ func (g *GhostscriptAgent) convertPdfToImage(ctx context.Context, params map[str
 	startTime := time.Now()
 	log.Printf("Starting PDF to image conversion for %d files", len(files))
 
-	if len(files) == 0 {
-		return nil, errors.New("no input files provided")
-	}
-
-	// Validate input files format
-	for _, inputFile := range files {
-		if !fileExists(inputFile) {
-			return nil, fmt.Errorf("input file not found: %s", inputFile)
-		}
-
-		ext := filepath.Ext(inputFile)
-		if !supportedInputFormats[ext] {
-			return nil, fmt.Errorf("unsupported input file format: %s", ext)
-		}
+	// Validate input files format, PostScript renders just like pdf
+	if err := validateInputFormats(files, supportedInputFormats); err != nil {
+		return nil, err
 	}
 
 	// Parse and validate parameters
@@ -94,115 +164,255 @@ func (g *GhostscriptAgent) convertPdfToImage(ctx context.Context, params map[str
 		return nil, fmt.Errorf("unsupported output image format: %s", imageFormat)
 	}
 
+	// Color mode is chosen independently of the container format
+	colorMode, _ := params["color_mode"].(string)
+	if colorMode == "" {
+		colorMode = "color"
+	}
+
+	device, err := getGsDevice(imageFormat, colorMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// TIFF can hold every page of a document in a single file
+	multiPage, _ := params["multi_page"].(bool)
+	if multiPage && !strings.HasPrefix(device, "tiff") {
+		return nil, apperrors.NewInvalidParameterError("multi_page", "only supported for tiff output")
+	}
+
 	antiAliasing, _ := params["anti_aliasing"].(bool)
 
+	encoding, err := parseEncodingOptions(params, device, antiAliasing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Target pixel dimensions replace the resolution
+	fit, err := parseFitOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	if fit != nil && multiPage && (fit.width == 0 || fit.height == 0 || fit.mode != fitContain) {
+		return nil, apperrors.NewInvalidParameterError("fit", "multi page tiff needs both width and height with fit contain")
+	}
+
+	// Optional stamp drawn over the rendered pages
+	watermark, err := g.parseWatermarkOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fonts the document does not embed
+	fonts, err := g.parseFontOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// ICC profiles the colors are converted with
+	color, err := g.parseColorOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	colorArgs, err := color.rasterArgs(colorModeSpace(colorMode))
+	if err != nil {
+		return nil, err
+	}
+
 	// If pdf is multiple pages, select the page of user's choice
 	pages, _ := params["pages"].(string)
 	if pages == "" {
-		pages = "1"
+		pages = defaultContentPages
 	}
 
-	outputDir, _ := params["output_dir"].(string)
-	if outputDir == "" {
-		outputDir = "output"
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create output directory only after all validations passed
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
 	}
 
-	var outputFiles []string
-	var mu sync.Mutex // Mutex to protect the outputFiles slice
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(files)) // Channel to collect errors
+	fontArgs, removeFontmap, err := fonts.prepare(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	defer removeFontmap()
+	fontReports := make([][]FontSubstitution, len(files))
 
-	for i, inputFile := range files {
-		fileStartTime := time.Now()
-		log.Printf("[%d/%d] Processing file: %s", i+1, len(files), inputFile)
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
 
-		wg.Add(1)
-		go func(file string, fileIdx int) {
-			defer wg.Done()
+		outputPattern := filepath.Join(fileOutputDir, fmt.Sprintf("%s-%%d.%s", baseNameWithoutExt, imageFormat))
+		if multiPage {
+			outputPattern = filepath.Join(fileOutputDir, fmt.Sprintf("%s.%s", baseNameWithoutExt, imageFormat))
+		}
+		log.Printf("Output pattern for file %s: %s", file, outputPattern)
+
+		// Resolve the page selection against the real page count,
+		// pixel sizes also need the size of every page
+		var info PdfInfo
+		if fit != nil && !multiPage {
+			if info, err = g.inspectFile(ctx, file, passwordFor(params, file)); err != nil {
+				return nil, err
+			}
+		} else if info.PageCount, err = g.pageCount(ctx, file, passwordFor(params, file)); err != nil {
+			return nil, err
+		}
+		pageCount := info.PageCount
+
+		selectedPages, err := selection.resolve(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
 
-			baseName := filepath.Base(file)
-			baseNameWithoutExt := strings.TrimSuffix(baseName, filepath.Ext(baseName))
-			fileOutputDir := filepath.Join(outputDir, baseNameWithoutExt)
+		// Pages of different sizes need different resolutions to come out at the same pixel size
+		passes := []renderPass{{pages: selectedPages, xres: float64(int(resolution)), yres: float64(int(resolution))}}
+		if fit != nil && !multiPage {
+			if passes, err = fit.planRenderPasses(selectedPages, info); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
 
-			// Create directory for this specific file
-			if err := os.MkdirAll(fileOutputDir, 0755); err != nil {
-				errCh <- fmt.Errorf("failed to create output directory for %s: %v", file, err)
-				return
+		var preludeFile string
+		var stamped []int
+		if watermark != nil {
+			if stamped, err = watermark.pages.resolve(pageCount); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
 			}
+			preludeFile = filepath.Join(fileOutputDir, baseNameWithoutExt+"_watermark.ps")
+			if err := watermark.writePrelude(preludeFile, true); err != nil {
+				return nil, err
+			}
+			defer os.Remove(preludeFile)
+		}
 
-			outputPattern := filepath.Join(fileOutputDir, fmt.Sprintf("%s-%%d.%s", baseNameWithoutExt, imageFormat))
-			log.Printf("Output pattern for file %s: %s", file, outputPattern)
+		filesByPage := make(map[int]string, len(selectedPages))
+		for passIdx, pass := range passes {
+			passPattern := outputPattern
+			if len(passes) > 1 {
+				passPattern = filepath.Join(fileOutputDir, fmt.Sprintf("%s-pass%d-%%d.%s", baseNameWithoutExt, passIdx+1, imageFormat))
+			}
 
 			// Process with ghostscript
-			args := []string{
-				"-dNOPAUSE",
-				"-dBATCH",
-				"-dSAFER",
-				fmt.Sprintf("-r%d", int(resolution)),
-				fmt.Sprintf("-sDEVICE=%s", getGsDevice(imageFormat)),
+			switches := append([]string{fmt.Sprintf("-sOutputFile=%s", passPattern)}, colorArgs...)
+			switches = append(switches, fontArgs...)
+			var programs []string
+			if watermark != nil {
+				programs = watermark.args(preludeFile, stampIndexes(pass.pages, stamped))
+			}
+			programs = append(programs, inputFileArgs(params, file)...)
+			args := renderPassArgs(device, encoding, fit, multiPage, pass, pageCount, switches, programs)
+
+			output, err := g.runGhostscript(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+
+			// Pages rendered with substituted fonts are discarded in strict mode
+			substitutions, err := fonts.check(file, output)
+			fontReports[fileIdx] = append(fontReports[fileIdx], substitutions...)
+			if err != nil {
+				os.RemoveAll(fileOutputDir)
+				return nil, err
 			}
 
-			if antiAliasing {
-				args = append(args, "-dTextAlphaBits=4", "-dGraphicsAlphaBits=4")
+			if multiPage {
+				return []string{outputPattern}, nil
 			}
 
-			// Set page range
-			if pages != "all" {
-				args = append(args, fmt.Sprintf("-dFirstPage=%s", pages))
-				args = append(args, fmt.Sprintf("-dLastPage=%s", pages))
+			// Name generated files after the pages they were rendered from
+			passOutputs, err := moveOutputFiles(passPattern, outputPattern, pass.pages)
+			if err != nil {
+				return nil, err
+			}
+			for i, page := range pass.pages {
+				filesByPage[page] = passOutputs[i]
+			}
+		}
+
+		outputs := make([]string, 0, len(selectedPages))
+		for _, page := range selectedPages {
+			outputs = append(outputs, filesByPage[page])
+		}
+
+		if encoding.pngCompression >= 0 {
+			if err := recompressPNGs(outputs, encoding.pngCompression); err != nil {
+				return nil, err
+			}
+		}
+		return outputs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if substitutions := fontMetadata(fontReports); len(substitutions) > 0 {
+		setMetadata(params, substitutions)
+	}
+
+	totalDuration := time.Since(startTime)
+	log.Printf("Completed PDF to image conversion for %d files in %v", len(files), totalDuration)
+
+	// Add metrics for monitoring if needed
+	if metricsCollector, ok := params["metrics"].(MetricsCollector); ok {
+		metricsCollector.RecordDuration("pdf_conversion_time", totalDuration)
+		metricsCollector.RecordCount("files_processed", len(files))
+		metricsCollector.RecordCount("output_files_generated", len(outputFiles))
+	}
+
+	return outputFiles, nil
+}
+
+// forEachFile run fn for every input file concurrently, within the agent's concurrency limits,
+// and collect the output files in input order
+func (g *GhostscriptAgent) forEachFile(ctx context.Context, files []string, fn func(file string, fileIdx int) ([]string, error)) ([]string, error) {
+	results := make([][]string, len(files))
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(files)) // Channel to collect errors
+
+	requestSlots := g.Limiter.requestSemaphore()
+	globalSlots := g.Limiter.globalSemaphore()
+
+	for i, inputFile := range files {
+		// Files past the per-request limit wait here, so they start in input order
+		if err := requestSlots.acquire(ctx); err != nil {
+			errCh <- err
+			break
+		}
+
+		wg.Add(1)
+		go func(file string, fileIdx int) {
+			defer wg.Done()
+			defer requestSlots.release()
+
+			if err := globalSlots.acquire(ctx); err != nil {
+				errCh <- err
+				return
 			}
+			defer globalSlots.release()
 
-			args = append(args,
-				fmt.Sprintf("-sOutputFile=%s", outputPattern),
-				file,
-			)
-
-			// Set up command with proper context
-			cmd := exec.CommandContext(ctx, g.BinaryPath, args...)
-
-			// Set up a proper cancellation mechanism
-			doneCh := make(chan struct{})
-			var output []byte
-			var cmdErr error
-
-			go func() {
-				output, cmdErr = cmd.CombinedOutput()
-				close(doneCh)
-			}()
-
-			select {
-			case <-ctx.Done():
-				// Context was cancelled, try to kill the process
-				if cmd.Process != nil {
-					cmd.Process.Kill()
-				}
+			// Skip files that have not started yet once the request is cancelled
+			if ctx.Err() != nil {
 				errCh <- ctx.Err()
 				return
-			case <-doneCh:
-				// Command completed
-				if cmdErr != nil {
-					errCh <- fmt.Errorf("ghostscript error: %v, output: %s", cmdErr, string(output))
-					return
-				}
 			}
 
-			// Get generated files
-			pattern := strings.Replace(outputPattern, "%d", "*", 1)
-			matches, err := filepath.Glob(pattern)
+			fileStartTime := time.Now()
+			log.Printf("[%d/%d] Processing file: %s", fileIdx+1, len(files), file)
+
+			outputs, err := fn(file, fileIdx)
 			if err != nil {
 				errCh <- err
 				return
 			}
-
-			// Thread-safe append to outputFiles
-			mu.Lock()
-			outputFiles = append(outputFiles, matches...)
-			mu.Unlock()
+			results[fileIdx] = outputs
 
 			log.Printf("[%d/%d] Completed processing file: %s (took %v)",
 				fileIdx+1, len(files), file, time.Since(fileStartTime))
@@ -220,29 +430,255 @@ func (g *GhostscriptAgent) convertPdfToImage(ctx context.Context, params map[str
 		}
 	}
 
-	totalDuration := time.Since(startTime)
-	log.Printf("Completed PDF to image conversion for %d files in %v", len(files), totalDuration)
+	var outputFiles []string
+	for _, outputs := range results {
+		outputFiles = append(outputFiles, outputs...)
+	}
+	return outputFiles, nil
+}
 
-	// Add metrics for monitoring if needed
-	if metricsCollector, ok := params["metrics"].(MetricsCollector); ok {
-		metricsCollector.RecordDuration("pdf_conversion_time", totalDuration)
-		metricsCollector.RecordCount("files_processed", len(files))
-		metricsCollector.RecordCount("output_files_generated", len(outputFiles))
+// makeFileOutputDir create the output subfolder for one input file,
+// returning it along with the input base name without extension
+func makeFileOutputDir(outputDir, file string) (string, string, error) {
+	baseName := filepath.Base(file)
+	baseNameWithoutExt := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+	fileOutputDir := filepath.Join(outputDir, baseNameWithoutExt)
+
+	// Create directory for this specific file
+	if err := os.MkdirAll(fileOutputDir, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create output directory for %s: %v", file, err)
 	}
+	return fileOutputDir, baseNameWithoutExt, nil
+}
 
-	return outputFiles, nil
+// validateInputFiles check input files exist and are pdfs
+func validateInputFiles(files []string) error {
+	return validateInputFormats(files, pdfInputFormats)
+}
+
+// validateInputFormats check input files exist and have one of the given formats
+func validateInputFormats(files []string, formats map[string]bool) error {
+	if len(files) == 0 {
+		return errors.New("no input files provided")
+	}
+
+	for _, inputFile := range files {
+		if !fileExists(inputFile) {
+			return fmt.Errorf("input file not found: %s", inputFile)
+		}
+
+		ext := strings.ToLower(filepath.Ext(inputFile))
+		if !formats[ext] {
+			return fmt.Errorf("unsupported input file format: %s", ext)
+		}
+	}
+	return nil
+}
+
+// prepareOutputDir create the per-request output directory
+func prepareOutputDir(params map[string]interface{}) (string, error) {
+	outputDir, _ := params["output_dir"].(string)
+	if outputDir == "" {
+		outputDir = "output"
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+	return outputDir, nil
+}
+
+// outputFilenameParam read an output file name parameter, keeping it inside the output directory
+func outputFilenameParam(params map[string]interface{}, defaultName, ext string) (string, error) {
+	name, _ := params["output_filename"].(string)
+	if name == "" {
+		return defaultName, nil
+	}
+
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", apperrors.NewInvalidParameterError("output_filename", "must be a plain file name")
+	}
+	if !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	return name, nil
+}
+
+// resolveInDir resolve a relative name inside dir, following symlinks, false when it leads outside dir or does not exist
+func resolveInDir(dir, name string) (string, bool) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", false
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", false
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil || !withinDirs(path, []string{root}) {
+		return "", false
+	}
+	return path, true
 }
 
-// getGsDevice retrieve matching ghostscript device
-func getGsDevice(format string) string {
+// wholeNumberParam read an optional whole number parameter, JSON numbers arrive as float64
+func wholeNumberParam(params map[string]interface{}, name string) (int, bool, error) {
+	raw, ok := params[name]
+	if !ok || raw == nil {
+		return 0, false, nil
+	}
+	value, ok := raw.(float64)
+	if !ok || value != float64(int(value)) {
+		return 0, false, apperrors.NewInvalidParameterError(name, "must be a whole number")
+	}
+	return int(value), true, nil
+}
+
+// pdfwriteArgs common arguments for writing a pdf with ghostscript
+func pdfwriteArgs(outputFile string) []string {
+	return []string{
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		"-sDEVICE=pdfwrite",
+		fmt.Sprintf("-sOutputFile=%s", outputFile),
+	}
+}
+
+// setMetadata hand structured per-file metadata back to the service through the request parameters
+func setMetadata(params map[string]interface{}, entries []interface{}) {
+	params["metadata"] = entries
+}
+
+// runGhostscript run ghostscript with the given arguments, killing it when ctx is cancelled
+func (g *GhostscriptAgent) runGhostscript(ctx context.Context, args []string) ([]byte, error) {
+	log.Printf("Running ghostscript: %s", strings.Join(redactArgs(args), " "))
+
+	// Jobs a pooled interpreter can run skip the process start
+	if g.Pool != nil {
+		if job, ok := g.Pool.job(args); ok {
+			return g.Pool.run(ctx, job, args)
+		}
+	}
+
+	// Set up command with proper context
+	cmd := exec.CommandContext(ctx, g.BinaryPath, args...)
+
+	// Set up a proper cancellation mechanism
+	doneCh := make(chan struct{})
+	var output []byte
+	var cmdErr error
+
+	go func() {
+		output, cmdErr = cmd.CombinedOutput()
+		close(doneCh)
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Context was cancelled, try to kill the process
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		return nil, ctx.Err()
+	case <-doneCh:
+		// Command completed
+		if cmdErr != nil {
+			if isPasswordFailure(output) {
+				return output, passwordError(args)
+			}
+			return output, fmt.Errorf("ghostscript error: %v, output: %s", cmdErr, string(output))
+		}
+	}
+
+	return output, nil
+}
+
+// pageCount ask ghostscript for the number of pages in a pdf or PostScript document
+func (g *GhostscriptAgent) pageCount(ctx context.Context, file, password string) (int, error) {
+	if isPostScript(file) {
+		info, err := g.postScriptInfo(ctx, file)
+		return info.PageCount, err
+	}
+
+	args := []string{
+		"-q",
+		"-dNODISPLAY",
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		fmt.Sprintf("--permit-file-read=%s", file),
+	}
+	if password != "" {
+		args = append(args, fmt.Sprintf("-sPDFPassword=%s", password))
+	}
+	args = append(args, "-c", fmt.Sprintf("%s (r) file runpdfbegin pdfpagecount =", psString(file)))
+
+	output, err := g.runGhostscript(ctx, args)
+	if err != nil {
+		return 0, err
+	}
+
+	// The count is the last line, anything before it is interpreter chatter
+	lines := strings.Fields(strings.TrimSpace(string(output)))
+	if len(lines) == 0 {
+		return 0, fmt.Errorf("failed to read page count of %s", file)
+	}
+	count, err := strconv.Atoi(lines[len(lines)-1])
+	if err != nil {
+		return 0, fmt.Errorf("failed to read page count of %s: %q", file, string(output))
+	}
+	return count, nil
+}
+
+// renumberOutputFiles rename files written through a %d output pattern, which ghostscript
+// numbers sequentially, after the pages they were rendered from. Returns files in page order.
+func renumberOutputFiles(outputPattern string, pages []int) ([]string, error) {
+	return moveOutputFiles(outputPattern, outputPattern, pages)
+}
+
+// moveOutputFiles rename files written sequentially through srcPattern to dstPattern numbered by page
+func moveOutputFiles(srcPattern, dstPattern string, pages []int) ([]string, error) {
+	files := make([]string, len(pages))
+	// Walk backwards so a rename never overwrites a file that is still to be renamed
+	for i := len(pages) - 1; i >= 0; i-- {
+		src := fmt.Sprintf(srcPattern, i+1)
+		dst := fmt.Sprintf(dstPattern, pages[i])
+		if !fileExists(src) {
+			return nil, fmt.Errorf("expected output file not generated: %s", src)
+		}
+		if src != dst {
+			if err := os.Rename(src, dst); err != nil {
+				return nil, err
+			}
+		}
+		files[i] = dst
+	}
+	return files, nil
+}
+
+// psString quote s as a PostScript string literal
+func psString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	return "(" + replacer.Replace(s) + ")"
+}
+
+// getGsDevice retrieve matching ghostscript device for an output format and color mode
+func getGsDevice(format, colorMode string) (string, error) {
 	switch format {
-	case "jpg", "jpeg":
-		return "jpeg"
-	case "png":
-		return "png16m"
-	default:
-		return "png16m" // Default to png if format not recognized
+	case "jpg":
+		format = "jpeg"
+	case "tif":
+		format = "tiff"
+	}
+
+	device, ok := gsDevices[format][colorMode]
+	if !ok {
+		return "", apperrors.NewUnsupportedFormatError(fmt.Sprintf("%s with color mode %s", format, colorMode))
 	}
+	return device, nil
 }
 
 // fileExists check if the file exist
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"testing"
+)
+
+func TestGetGsDevice(t *testing.T) {
+	testCases := []struct {
+		name        string
+		format      string
+		colorMode   string
+		expected    string
+		expectError bool
+	}{
+		{name: "Color png", format: "png", colorMode: "color", expected: "png16m"},
+		{name: "Jpg alias", format: "jpg", colorMode: "color", expected: "jpeg"},
+		{name: "Gray png", format: "png", colorMode: "gray", expected: "pnggray"},
+		{name: "Mono png", format: "png", colorMode: "mono", expected: "pngmono"},
+		{name: "Alpha png", format: "png", colorMode: "alpha", expected: "pngalpha"},
+		{name: "Fax tiff", format: "tif", colorMode: "mono", expected: "tiffg4"},
+		{name: "Color tiff", format: "tiff", colorMode: "color", expected: "tiff24nc"},
+		{name: "Gray tiff", format: "tiff", colorMode: "gray", expected: "tiffgray"},
+		{name: "Color bmp", format: "bmp", colorMode: "color", expected: "bmp16m"},
+		{name: "Alpha jpeg", format: "jpeg", colorMode: "alpha", expectError: true},
+		{name: "Unknown format", format: "gif", colorMode: "color", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			device, err := getGsDevice(tc.format, tc.colorMode)
+			if tc.expectError {
+				if !apperrors.IsUnsupportedFormat(err) {
+					t.Errorf("Expected unsupported format error, got device %q, err %v", device, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if device != tc.expected {
+				t.Errorf("Expected device %s, got %s", tc.expected, device)
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package agent
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Input formats of convertImagesToPdf
+var imageInputFormats = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// defaultImageDPI resolution assumed for images that do not record one
+const defaultImageDPI = 72
+
+// maxImagePixels largest image or page accepted, guarding against forged dimensions
+const maxImagePixels = 1 << 28
+
+// fitActual fit mode placing images at the size given by their resolution
+const fitActual = "actual"
+
+// pdfImage image XObject ready to be written to a pdf
+type pdfImage struct {
+	width, height    int
+	colorSpace       string
+	bitsPerComponent int
+	filter           string
+	decodeParms      string // empty when the filter takes none
+	decode           string // empty for the default decode array
+	data             []byte
+	smask            []byte // Flate compressed 8 bit alpha, nil when opaque
+	dpiX, dpiY       float64
+}
+
+// pointSize size of the image in points, at dpi when given, else at the resolution the image records
+func (img *pdfImage) pointSize(dpi float64) (float64, float64) {
+	dpiX, dpiY := img.dpiX, img.dpiY
+	if dpi > 0 {
+		dpiX, dpiY = dpi, dpi
+	}
+	if dpiX <= 0 || dpiY <= 0 {
+		dpiX, dpiY = defaultImageDPI, defaultImageDPI
+	}
+	return float64(img.width) * 72 / dpiX, float64(img.height) * 72 / dpiY
+}
+
+// imageLayout placement of each image on its page
+type imageLayout struct {
+	paper      *[2]float64 // nil when every page takes the size of its image
+	margin     float64
+	mode       string
+	autoOrient bool
+}
+
+// parseImageLayout read page size, margin and fit parameters of convertImagesToPdf
+func parseImageLayout(params map[string]interface{}) (*imageLayout, error) {
+	layout := &imageLayout{mode: fitContain, autoOrient: true}
+
+	margin, err := marginParam(params)
+	if err != nil {
+		return nil, err
+	}
+	layout.margin = margin
+
+	if layout.paper, err = optionalPaperSizeParam(params); err != nil {
+		return nil, err
+	}
+
+	if mode, ok := params["fit_mode"].(string); ok && mode != "" {
+		if layout.paper == nil {
+			return nil, apperrors.NewInvalidParameterError("fit_mode", "needs paper_size or page_width and page_height")
+		}
+		switch mode {
+		case fitContain, fitCover, fitExact, fitActual:
+		default:
+			return nil, apperrors.NewInvalidParameterError("fit_mode", fmt.Sprintf("unsupported fit mode %q", mode))
+		}
+		layout.mode = mode
+	}
+
+	// An explicit orientation wins over following the image
+	if _, ok := params["landscape"]; ok {
+		layout.autoOrient = false
+	}
+	if autoOrient, ok := params["auto_orient"].(bool); ok {
+		layout.autoOrient = autoOrient
+	}
+
+	return layout, nil
+}
+
+// place page size and the rectangle, as x, y, width and height, the image is drawn into.
+// Images are clipped to the page less its margins.
+func (l imageLayout) place(imageWidth, imageHeight float64) ([2]float64, [4]float64, [4]float64) {
+	m := l.margin
+	if l.paper == nil {
+		page := [2]float64{imageWidth + 2*m, imageHeight + 2*m}
+		rect := [4]float64{m, m, imageWidth, imageHeight}
+		return page, rect, rect
+	}
+
+	page := *l.paper
+	if l.autoOrient && (imageWidth > imageHeight) != (page[0] > page[1]) && page[0] != page[1] {
+		page[0], page[1] = page[1], page[0]
+	}
+	availWidth, availHeight := page[0]-2*m, page[1]-2*m
+
+	width, height := imageWidth, imageHeight
+	switch l.mode {
+	case fitContain:
+		scale := min(availWidth/imageWidth, availHeight/imageHeight)
+		width, height = imageWidth*scale, imageHeight*scale
+	case fitCover:
+		scale := max(availWidth/imageWidth, availHeight/imageHeight)
+		width, height = imageWidth*scale, imageHeight*scale
+	case fitExact:
+		width, height = availWidth, availHeight
+	}
+
+	rect := [4]float64{(page[0] - width) / 2, (page[1] - height) / 2, width, height}
+	return page, rect, [4]float64{m, m, availWidth, availHeight}
+}
+
+// loadImageFile read a JPEG, PNG or TIFF file, TIFF files may hold several pages
+func loadImageFile(path string) ([]*pdfImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		img, err := jpegImage(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*pdfImage{img}, nil
+	case ".png":
+		img, err := pngImage(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*pdfImage{img}, nil
+	default:
+		return decodeTIFF(data)
+	}
+}
+
+// jpegImage embed a JPEG file unchanged, pdf readers decode DCT themselves
+func jpegImage(data []byte) (*pdfImage, error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JPEG: %v", err)
+	}
+	if err := checkImageSize(cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode JPEG: %v", err)
+	}
+
+	img := &pdfImage{
+		width:            cfg.Width,
+		height:           cfg.Height,
+		colorSpace:       "/DeviceRGB",
+		bitsPerComponent: 8,
+		filter:           "/DCTDecode",
+		data:             data,
+	}
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		img.colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		// CMYK JPEGs are written inverted, the Adobe convention
+		img.colorSpace, img.decode = "/DeviceCMYK", "[1 0 1 0 1 0 1 0]"
+	}
+	img.dpiX, img.dpiY = jfifDensity(data)
+	return img, nil
+}
+
+// jfifDensity resolution recorded in the JFIF header of a JPEG, 0 when absent
+func jfifDensity(data []byte) (float64, float64) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, 0
+	}
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		// A length covers its own two bytes, anything shorter or past the end is corrupt
+		if marker == 0xda || length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe0 && len(segment) >= 12 && string(segment[:5]) == "JFIF\x00" {
+			x := float64(binary.BigEndian.Uint16(segment[8:]))
+			y := float64(binary.BigEndian.Uint16(segment[10:]))
+			switch segment[7] {
+			case 1:
+				return x, y
+			case 2:
+				return x * 2.54, y * 2.54
+			}
+			return 0, 0
+		}
+		pos += 2 + length
+	}
+	return 0, 0
+}
+
+// pngImage decode a PNG into 8 bit samples, with alpha as a soft mask
+func pngImage(data []byte) (*pdfImage, error) {
+	// The header is checked first, the decoder allocates all pixels up front
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode PNG: %v", err)
+	}
+	if err := checkImageSize(cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode PNG: %v", err)
+	}
+
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode PNG: %v", err)
+	}
+
+	img, err := rasterImage(src)
+	if err != nil {
+		return nil, err
+	}
+	img.dpiX, img.dpiY = pngDensity(data)
+	return img, nil
+}
+
+// checkImageSize refuse images whose header claims more than maxImagePixels
+func checkImageSize(cfg image.Config) error {
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxImagePixels/cfg.Height {
+		return fmt.Errorf("%dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// rasterImage Flate compressed 8 bit samples of a decoded image, gray stays gray and
+// everything else becomes RGB with alpha as a soft mask
+func rasterImage(src image.Image) (*pdfImage, error) {
+	bounds := src.Bounds()
+	img := &pdfImage{
+		width:            bounds.Dx(),
+		height:           bounds.Dy(),
+		colorSpace:       "/DeviceRGB",
+		bitsPerComponent: 8,
+		filter:           "/FlateDecode",
+	}
+
+	var err error
+	var samples []byte
+	switch src.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		img.colorSpace = "/DeviceGray"
+		samples = make([]byte, 0, img.width*img.height)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				samples = append(samples, color.GrayModel.Convert(src.At(x, y)).(color.Gray).Y)
+			}
+		}
+	default:
+		samples = make([]byte, 0, img.width*img.height*3)
+		alpha := make([]byte, 0, img.width*img.height)
+		opaque := true
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+				samples = append(samples, c.R, c.G, c.B)
+				alpha = append(alpha, c.A)
+				opaque = opaque && c.A == 0xff
+			}
+		}
+		if !opaque {
+			if img.smask, err = deflate(alpha); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if img.data, err = deflate(samples); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// deflate compress data for a FlateDecode stream
+func deflate(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// pngDensity resolution recorded in the pHYs chunk of a PNG, 0 when absent
+func pngDensity(data []byte) (float64, float64) {
+	const signatureSize = 8
+	for pos := signatureSize; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) || chunkType == "IDAT" {
+			break
+		}
+		if chunkType == "pHYs" && length == 9 {
+			chunk := data[pos+8:]
+			if chunk[8] != 1 {
+				// Unit is not the meter, only the aspect ratio is known
+				return 0, 0
+			}
+			x := float64(binary.BigEndian.Uint32(chunk))
+			y := float64(binary.BigEndian.Uint32(chunk[4:]))
+			return x * 0.0254, y * 0.0254
+		}
+		pos += 12 + length
+	}
+	return 0, 0
+}
+
+// dict image XObject dictionary entries, besides /Length
+func (img *pdfImage) dict(smask int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent %d /Filter %s",
+		img.width, img.height, img.colorSpace, img.bitsPerComponent, img.filter)
+	if img.decodeParms != "" {
+		fmt.Fprintf(&b, " /DecodeParms %s", img.decodeParms)
+	}
+	if img.decode != "" {
+		fmt.Fprintf(&b, " /Decode %s", img.decode)
+	}
+	if smask != 0 {
+		fmt.Fprintf(&b, " /SMask %d 0 R", smask)
+	}
+	return b.String()
+}
+
+// writeImagePage write img and a page showing it, returning the page object number
+func writeImagePage(doc *pdfDocument, parent int, img *pdfImage, layout imageLayout, dpi float64) int {
+	page, rect, clip := layout.place(img.pointSize(dpi))
+
+	var smask int
+	if img.smask != nil {
+		smask = doc.newObject()
+		doc.writeStream(smask, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d "+
+			"/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.smask)
+	}
+	imageObj := doc.newObject()
+	doc.writeStream(imageObj, img.dict(smask), img.data)
+
+	content := doc.newObject()
+	doc.writeStream(content, "", []byte(fmt.Sprintf("q %s %s %s %s re W n %s 0 0 %s %s %s cm /Im0 Do Q",
+		pdfNumber(clip[0]), pdfNumber(clip[1]), pdfNumber(clip[2]), pdfNumber(clip[3]),
+		pdfNumber(rect[2]), pdfNumber(rect[3]), pdfNumber(rect[0]), pdfNumber(rect[1]))))
+
+	pageObj := doc.newObject()
+	doc.writeObject(pageObj, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] "+
+		"/Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		parent, pdfNumber(page[0]), pdfNumber(page[1]), imageObj, content))
+	return pageObj
+}
+
+// convertImagesToPdf assemble JPEG, PNG and TIFF images, in order, into a single pdf with one image per page
+func (g *GhostscriptAgent) convertImagesToPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting image to PDF conversion for %d files", len(files))
+
+	if err := validateInputFormats(files, imageInputFormats); err != nil {
+		return nil, err
+	}
+
+	layout, err := parseImageLayout(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// A resolution hint overrides whatever the images record
+	dpi, _ := params["dpi"].(float64)
+	if _, ok := params["dpi"]; ok && (dpi < 1 || dpi > 2400) {
+		return nil, apperrors.NewInvalidParameterError("dpi", "must be between 1 and 2400")
+	}
+
+	outputName, err := outputFilenameParam(params, "images.pdf", ".pdf")
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+	outputFile := filepath.Join(outputDir, outputName)
+
+	doc, err := createPdfDocument(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", outputFile, err)
+	}
+	catalog, pages := doc.newObject(), doc.newObject()
+
+	// Images are loaded one file at a time to bound memory use
+	var kids []string
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			doc.abort()
+			os.Remove(outputFile)
+			return nil, err
+		}
+
+		images, err := loadImageFile(file)
+		if err != nil {
+			doc.abort()
+			os.Remove(outputFile)
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, img := range images {
+			page := writeImagePage(doc, pages, img, *layout, dpi)
+			kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		}
+	}
+
+	doc.writeObject(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	doc.writeObject(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	if err := doc.close(catalog); err != nil {
+		os.Remove(outputFile)
+		return nil, fmt.Errorf("failed to write %s: %v", outputFile, err)
+	}
+
+	log.Printf("Completed image to PDF conversion of %d files into %s in %v", len(files), outputFile, time.Since(startTime))
+
+	return []string{outputFile}, nil
+}
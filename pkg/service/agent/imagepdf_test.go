@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImageLayoutPlace(t *testing.T) {
+	a4 := [2]float64{595, 842}
+
+	testCases := []struct {
+		name         string
+		layout       imageLayout
+		imageWidth   float64
+		imageHeight  float64
+		expectedPage [2]float64
+		expectedRect [4]float64
+	}{
+		{name: "Image sized page", layout: imageLayout{margin: 10}, imageWidth: 200, imageHeight: 100,
+			expectedPage: [2]float64{220, 120}, expectedRect: [4]float64{10, 10, 200, 100}},
+		{name: "Contain", layout: imageLayout{paper: &a4, mode: fitContain}, imageWidth: 1190, imageHeight: 842,
+			expectedPage: [2]float64{595, 842}, expectedRect: [4]float64{0, 210.5, 595, 421}},
+		{name: "Auto orient", layout: imageLayout{paper: &a4, mode: fitContain, autoOrient: true}, imageWidth: 1684, imageHeight: 1190,
+			expectedPage: [2]float64{842, 595}, expectedRect: [4]float64{0, 0, 842, 595}},
+		{name: "Actual size", layout: imageLayout{paper: &a4, mode: fitActual}, imageWidth: 100, imageHeight: 200,
+			expectedPage: [2]float64{595, 842}, expectedRect: [4]float64{247.5, 321, 100, 200}},
+		{name: "Exact with margin", layout: imageLayout{paper: &a4, mode: fitExact, margin: 20}, imageWidth: 100, imageHeight: 200,
+			expectedPage: [2]float64{595, 842}, expectedRect: [4]float64{20, 20, 555, 802}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, rect, _ := tc.layout.place(tc.imageWidth, tc.imageHeight)
+			if page != tc.expectedPage {
+				t.Errorf("Expected page %v, got %v", tc.expectedPage, page)
+			}
+			if rect != tc.expectedRect {
+				t.Errorf("Expected rect %v, got %v", tc.expectedRect, rect)
+			}
+		})
+	}
+}
+
+func TestImageDensity(t *testing.T) {
+	jfif := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x01, 0x01, 0x2c, 0x00, 0x96, 0x00, 0x00, 0xff, 0xda}
+	if x, y := jfifDensity(jfif); x != 300 || y != 150 {
+		t.Errorf("Expected JFIF density 300x150, got %vx%v", x, y)
+	}
+
+	// Corrupt segment lengths end the scan instead of slicing out of range
+	for name, data := range map[string][]byte{
+		"Zero length segment": {0xff, 0xd8, 0xff, 0xe0, 0x00, 0x02, 0xff, 0xc0, 0x00, 0x02, 0xff, 0xe1, 0x00, 0x00, 0xff, 0xda},
+		"One byte length":     {0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 0xff, 0xda},
+		"Length past the end": {0xff, 0xd8, 0xff, 0xe0, 0x00, 0x40, 'J', 'F', 'I', 'F', 0x00},
+		"Short JFIF segment":  {0xff, 0xd8, 0xff, 0xe0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0x00, 0xff, 0xda},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if x, y := jfifDensity(data); x != 0 || y != 0 {
+				t.Errorf("Expected no density, got %vx%v", x, y)
+			}
+		})
+	}
+
+	phys := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x09pHYs\x00\x00\x2e\x23\x00\x00\x2e\x23\x01\x00\x00\x00\x00")
+	if x, _ := pngDensity(phys); x < 299.9 || x > 300.1 {
+		t.Errorf("Expected PNG density of about 300, got %v", x)
+	}
+}
+
+func TestConvertImagesToPdf(t *testing.T) {
+	dir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	img.Set(1, 1, color.RGBA{R: 255, A: 128})
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	pngFile, jpegFile := filepath.Join(dir, "scan.png"), filepath.Join(dir, "photo.jpg")
+	os.WriteFile(pngFile, pngData.Bytes(), 0644)
+	os.WriteFile(jpegFile, jpegData.Bytes(), 0644)
+
+	agent := NewGhostscriptAgent("gs", dir)
+	params := map[string]interface{}{"output_dir": filepath.Join(dir, "out"), "paper_size": "a4", "margin": 36.0}
+	outputs, err := agent.Execute(context.Background(), "convertImagesToPdf", params, []string{pngFile, jpegFile})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("Expected a single pdf, got %v", outputs)
+	}
+
+	data, err := os.ReadFile(outputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"%PDF-1.4", "/Count 2", "/DCTDecode", "/SMask", "%%EOF"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected output to contain %q", want)
+		}
+	}
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1, 1))
+
+	// Forge the dimensions in the headers, which are all the size check reads
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, src); err != nil {
+		t.Fatal(err)
+	}
+	forgedPNG := pngBuf.Bytes()
+	binary.BigEndian.PutUint32(forgedPNG[16:], 40000)
+	binary.BigEndian.PutUint32(forgedPNG[20:], 40000)
+	binary.BigEndian.PutUint32(forgedPNG[29:], crc32.ChecksumIEEE(forgedPNG[12:29]))
+
+	var jpegBuf bytes.Buffer
+	if err := jpeg.Encode(&jpegBuf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	forgedJPEG := jpegBuf.Bytes()
+	sof := bytes.Index(forgedJPEG, []byte{0xff, 0xc0})
+	if sof < 0 {
+		t.Fatal("Expected a baseline JPEG frame header")
+	}
+	binary.BigEndian.PutUint16(forgedJPEG[sof+5:], 40000)
+	binary.BigEndian.PutUint16(forgedJPEG[sof+7:], 40000)
+
+	testCases := []struct {
+		name   string
+		decode func([]byte) (*pdfImage, error)
+		data   []byte
+	}{
+		{name: "PNG", decode: pngImage, data: forgedPNG},
+		{name: "JPEG", decode: jpegImage, data: forgedJPEG},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.decode(tc.data)
+			if err == nil || !strings.Contains(err.Error(), "40000x40000 pixels is too large") {
+				t.Errorf("Expected the image size to be refused, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default resolution of the ink coverage pass, finer pixels barely change the coverage
+const defaultInkResolution = 75
+
+// Process inks in the order separations are reported, spot colors follow by name
+var processSeparations = map[string]int{
+	"Cyan":    0,
+	"Magenta": 1,
+	"Yellow":  2,
+	"Black":   3,
+}
+
+// InkCoverage share of a page covered by each process ink, in percent of the page area
+type InkCoverage struct {
+	File        string   `json:"file"`
+	Page        int      `json:"page"`
+	Cyan        float64  `json:"cyan"`
+	Magenta     float64  `json:"magenta"`
+	Yellow      float64  `json:"yellow"`
+	Black       float64  `json:"black"`
+	Separations []string `json:"separations,omitempty"`
+}
+
+// inkResolutionParam read the optional rendering resolution of the ink passes
+func inkResolutionParam(params map[string]interface{}, defaultResolution int) (int, error) {
+	resolution, ok, err := wholeNumberParam(params, "resolution")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return defaultResolution, nil
+	}
+	if resolution < 1 || resolution > 1200 {
+		return 0, apperrors.NewInvalidParameterError("resolution", "must be between 1 and 1200")
+	}
+	return resolution, nil
+}
+
+// inkCoverage measure the ink coverage of the given pages of file with the inkcov device
+func (g *GhostscriptAgent) inkCoverage(ctx context.Context, params map[string]interface{}, file string, pages []int, pageCount, resolution int, colorArgs []string) ([]InkCoverage, error) {
+	args := []string{
+		"-q",
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		"-sDEVICE=inkcov",
+		fmt.Sprintf("-r%d", resolution),
+		"-sOutputFile=%stdout",
+	}
+	args = append(args, pageSelectionArgs(pages, pageCount)...)
+	args = append(args, colorArgs...)
+	args = append(args, inputFileArgs(params, file)...)
+
+	output, err := g.runGhostscript(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage, err := parseInkCoverage(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure ink coverage of %s: %v", file, err)
+	}
+	if len(coverage) != len(pages) {
+		return nil, fmt.Errorf("failed to measure ink coverage of %s: expected %d pages, got %d", file, len(pages), len(coverage))
+	}
+	for i := range coverage {
+		coverage[i].File = file
+		coverage[i].Page = pages[i]
+	}
+	return coverage, nil
+}
+
+// parseInkCoverage read the "C M Y K CMYK OK" lines the inkcov device prints, one per rendered page
+func parseInkCoverage(output []byte) ([]InkCoverage, error) {
+	var coverage []InkCoverage
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[4] != "CMYK" || fields[5] != "OK" {
+			continue
+		}
+
+		var inks [4]float64
+		for i := range inks {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid coverage %q", fields[i])
+			}
+			// Fractions of the page area, reported as percentages
+			inks[i] = math.Round(value*100000) / 1000
+		}
+		coverage = append(coverage, InkCoverage{Cyan: inks[0], Magenta: inks[1], Yellow: inks[2], Black: inks[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
+
+// collectSeparations rename the separations tiffsep wrote for each rendered page after the page number,
+// returning them per page with the process inks first
+func collectSeparations(dir, baseName string, pages []int) ([][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// tiffsep names each separation <pattern>(<ink>).tif
+	inks := make(map[int][]string)
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), baseName+"-")
+		if !ok {
+			continue
+		}
+		seqText, ink, ok := strings.Cut(rest, "(")
+		if !ok || !strings.HasSuffix(ink, ").tif") {
+			continue
+		}
+		seq, err := strconv.Atoi(seqText)
+		if err != nil {
+			continue
+		}
+		inks[seq] = append(inks[seq], strings.TrimSuffix(ink, ").tif"))
+	}
+
+	separations := make([][]string, len(pages))
+	// Walk backwards so a rename never overwrites a file that is still to be renamed
+	for i := len(pages) - 1; i >= 0; i-- {
+		pageInks := inks[i+1]
+		if len(pageInks) == 0 {
+			return nil, fmt.Errorf("expected separations not generated for page %d", pages[i])
+		}
+		sortSeparations(pageInks)
+
+		for _, ink := range pageInks {
+			src := filepath.Join(dir, fmt.Sprintf("%s-%d(%s).tif", baseName, i+1, ink))
+			dst := filepath.Join(dir, fmt.Sprintf("%s-%d(%s).tif", baseName, pages[i], ink))
+			if src != dst {
+				if err := os.Rename(src, dst); err != nil {
+					return nil, err
+				}
+			}
+			separations[i] = append(separations[i], dst)
+		}
+	}
+	return separations, nil
+}
+
+// sortSeparations order ink names cyan, magenta, yellow, black, then spot colors by name
+func sortSeparations(inks []string) {
+	sort.Slice(inks, func(i, j int) bool {
+		pi, iProcess := processSeparations[inks[i]]
+		pj, jProcess := processSeparations[inks[j]]
+		switch {
+		case iProcess && jProcess:
+			return pi < pj
+		case iProcess != jProcess:
+			return iProcess
+		}
+		return inks[i] < inks[j]
+	})
+}
+
+// reportInkCoverage report the C, M, Y and K coverage of each page, optionally
+// rendering every page as one grayscale image per separation
+func (g *GhostscriptAgent) reportInkCoverage(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting ink coverage report for %d files", len(files))
+
+	if err := validateInputFormats(files, supportedInputFormats); err != nil {
+		return nil, err
+	}
+
+	resolution, err := inkResolutionParam(params, defaultInkResolution)
+	if err != nil {
+		return nil, err
+	}
+	separations, _ := params["separations"].(bool)
+
+	// Coverage is measured after conversion through the CMYK output profile, if one is given
+	color, err := g.parseColorOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	colorArgs, err := color.rasterArgs("CMYK")
+	if err != nil {
+		return nil, err
+	}
+
+	pages, _ := params["pages"].(string)
+	if pages == "" {
+		pages = "all"
+	}
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([][]InkCoverage, len(files))
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		selectedPages, err := selection.resolve(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		coverage, err := g.inkCoverage(ctx, params, file, selectedPages, pageCount, resolution, colorArgs)
+		if err != nil {
+			return nil, err
+		}
+		reports[fileIdx] = coverage
+		if !separations {
+			return nil, nil
+		}
+
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputPattern := filepath.Join(fileOutputDir, fmt.Sprintf("%s-%%d.tif", baseNameWithoutExt))
+
+		args := []string{
+			"-dNOPAUSE",
+			"-dBATCH",
+			"-dSAFER",
+			"-sDEVICE=tiffsep",
+			"-sCompression=lzw",
+			fmt.Sprintf("-r%d", resolution),
+			fmt.Sprintf("-sOutputFile=%s", outputPattern),
+		}
+		args = append(args, pageSelectionArgs(selectedPages, pageCount)...)
+		args = append(args, colorArgs...)
+		args = append(args, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+
+		// Only the separations are kept, not the composite CMYK pages
+		for i := range selectedPages {
+			os.Remove(fmt.Sprintf(outputPattern, i+1))
+		}
+
+		pageSeparations, err := collectSeparations(fileOutputDir, baseNameWithoutExt, selectedPages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		var outputs []string
+		for i := range coverage {
+			coverage[i].Separations = pageSeparations[i]
+			outputs = append(outputs, pageSeparations[i]...)
+		}
+		return outputs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []interface{}
+	for _, coverage := range reports {
+		for _, page := range coverage {
+			entries = append(entries, page)
+		}
+	}
+	setMetadata(params, entries)
+
+	log.Printf("Completed ink coverage report for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInkCoverage(t *testing.T) {
+	output := "Page 1\n 0.02024  0.01915  0.01856  0.03403 CMYK OK\n 0.00000  0.00000  0.00000  0.00000 CMYK OK\n"
+	expected := []InkCoverage{
+		{Cyan: 2.024, Magenta: 1.915, Yellow: 1.856, Black: 3.403},
+		{},
+	}
+
+	coverage, err := parseInkCoverage([]byte(output))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(coverage, expected) {
+		t.Errorf("Expected coverage %v, got %v", expected, coverage)
+	}
+
+	if _, err := parseInkCoverage([]byte(" 0.1 x 0.1 0.1 CMYK OK\n")); err == nil {
+		t.Error("Expected an error for an invalid coverage value")
+	}
+}
+
+func TestCollectSeparations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"doc-1(Black).tif", "doc-1(Cyan).tif", "doc-1(Magenta).tif", "doc-1(Yellow).tif",
+		"doc-2(Black).tif", "doc-2(Cyan).tif", "doc-2(Magenta).tif", "doc-2(Yellow).tif", "doc-2(PANTONE 185 C).tif",
+		"doc-2.tif", "other-1(Cyan).tif",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	separations, err := collectSeparations(dir, "doc", []int{2, 5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"doc-2(Cyan).tif", "doc-2(Magenta).tif", "doc-2(Yellow).tif", "doc-2(Black).tif"},
+		{"doc-5(Cyan).tif", "doc-5(Magenta).tif", "doc-5(Yellow).tif", "doc-5(Black).tif", "doc-5(PANTONE 185 C).tif"},
+	}
+	for i := range expected {
+		for j, name := range expected[i] {
+			expected[i][j] = filepath.Join(dir, name)
+			if !fileExists(expected[i][j]) {
+				t.Errorf("Expected %s to exist", name)
+			}
+		}
+	}
+	if !reflect.DeepEqual(separations, expected) {
+		t.Errorf("Expected separations %v, got %v", expected, separations)
+	}
+
+	if _, err := collectSeparations(dir, "doc", []int{1, 2, 3}); err == nil {
+		t.Error("Expected an error for a page without separations")
+	}
+}
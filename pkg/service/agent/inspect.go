@@ -0,0 +1,270 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Info dictionary keys reported by inspectPdf
+var pdfInfoKeys = []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer", "CreationDate", "ModDate"}
+
+// PageInfo geometry of a single pdf page, boxes are [llx lly urx ury] in points
+type PageInfo struct {
+	Number   int       `json:"number"`
+	MediaBox []float64 `json:"media_box"`
+	CropBox  []float64 `json:"crop_box"`
+	Rotate   int       `json:"rotate"`
+}
+
+// PdfInfo inspection report for one pdf
+type PdfInfo struct {
+	File       string            `json:"file"`
+	PageCount  int               `json:"page_count"`
+	PDFVersion string            `json:"pdf_version"`
+	Encrypted  bool              `json:"encrypted"`
+	Linearized bool              `json:"linearized"`
+	Info       map[string]string `json:"info"`
+	Pages      []PageInfo        `json:"pages"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// pdfInspectProgram PostScript printing page count, encryption, Info fields and page boxes as tab separated lines
+const pdfInspectProgram = `
+(r) file runpdfbegin
+(PAGECOUNT\t) print pdfpagecount =
+(ENCRYPTED\t) print Trailer /Encrypt known =
+Trailer /Info knownoget {
+  [%s] {
+    2 copy knownoget {
+      exch (INFO\t) print =only (\t) print
+      dup type /stringtype eq { = } { == } ifelse
+    } { pop } ifelse
+  } forall pop
+} if
+1 1 pdfpagecount {
+  dup (PAGE\t) print =only (\t) print
+  pdfgetpage
+  dup /MediaBox pget { ==only } { ([]) print } ifelse (\t) print
+  dup /CropBox pget { ==only } { ([]) print } ifelse (\t) print
+  /Rotate pget { =only } { (0) print } ifelse
+  (\n) print
+} for
+quit
+`
+
+// inspectPdf report page count, page sizes and document info of each input pdf as metadata
+func (g *GhostscriptAgent) inspectPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF inspection for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	reports := make([]interface{}, len(files))
+	_, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		info, err := g.inspectFile(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		reports[fileIdx] = info
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	setMetadata(params, reports)
+
+	log.Printf("Completed PDF inspection for %d files in %v", len(files), time.Since(startTime))
+
+	return []string{}, nil
+}
+
+// inspectFile collect the inspection report of a single pdf or PostScript document
+func (g *GhostscriptAgent) inspectFile(ctx context.Context, file, password string) (PdfInfo, error) {
+	if isPostScript(file) {
+		return g.postScriptInfo(ctx, file)
+	}
+
+	info := PdfInfo{
+		File: file,
+		Info: make(map[string]string),
+	}
+
+	// Version and linearization come straight from the file structure
+	version, err := readPDFVersion(file)
+	if err != nil {
+		return info, err
+	}
+	info.PDFVersion = version
+
+	if info.Linearized, err = isLinearized(file); err != nil {
+		return info, err
+	}
+
+	keys := make([]string, len(pdfInfoKeys))
+	for i, key := range pdfInfoKeys {
+		keys[i] = "/" + key
+	}
+
+	args := []string{
+		"-q",
+		"-dNODISPLAY",
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		fmt.Sprintf("--permit-file-read=%s", file),
+	}
+	if password != "" {
+		args = append(args, fmt.Sprintf("-sPDFPassword=%s", password))
+	}
+	args = append(args, "-c", psString(file)+fmt.Sprintf(pdfInspectProgram, strings.Join(keys, " ")))
+
+	output, err := g.runGhostscript(ctx, args)
+	if err != nil {
+		// Without a password an encrypted file only yields what the file structure tells
+		if password == "" && apperrors.IsPasswordError(err) {
+			info.Encrypted = true
+			info.Error = "document is encrypted"
+			return info, nil
+		}
+		return info, err
+	}
+
+	if err := parseInspectOutput(output, &info); err != nil {
+		return info, fmt.Errorf("failed to inspect %s: %v", file, err)
+	}
+	return info, nil
+}
+
+// parseInspectOutput fill info from the lines printed by pdfInspectProgram
+func parseInspectOutput(output []byte, info *PdfInfo) error {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch fields[0] {
+		case "PAGECOUNT":
+			if len(fields) < 2 {
+				continue
+			}
+			count, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+			if err != nil {
+				return fmt.Errorf("invalid page count %q", fields[1])
+			}
+			info.PageCount = count
+		case "ENCRYPTED":
+			if len(fields) < 2 {
+				continue
+			}
+			// Set from the trailer, a /Encrypt token elsewhere in the file does not count
+			info.Encrypted = strings.TrimSpace(fields[1]) == "true"
+		case "INFO":
+			if len(fields) < 3 {
+				continue
+			}
+			info.Info[fields[1]] = decodePDFString(strings.Join(fields[2:], "\t"))
+		case "PAGE":
+			if len(fields) < 5 {
+				return fmt.Errorf("malformed page line %q", scanner.Text())
+			}
+			number, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return fmt.Errorf("invalid page number %q", fields[1])
+			}
+			rotate, _ := strconv.Atoi(strings.TrimSpace(fields[4]))
+			page := PageInfo{
+				Number:   number,
+				MediaBox: parsePSNumberArray(fields[2]),
+				CropBox:  parsePSNumberArray(fields[3]),
+				Rotate:   ((rotate % 360) + 360) % 360,
+			}
+			if page.CropBox == nil {
+				page.CropBox = page.MediaBox
+			}
+			info.Pages = append(info.Pages, page)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if info.PageCount == 0 {
+		return fmt.Errorf("no page count in ghostscript output")
+	}
+	return nil
+}
+
+// parsePSNumberArray parse a PostScript number array such as "[0 0 612.0 792]"
+func parsePSNumberArray(s string) []float64 {
+	if values := parsePSNumbers(s); len(values) == 4 {
+		return values
+	}
+	return nil
+}
+
+// parsePSNumbers parse the numbers of a printed PostScript array, nil if any is not a number
+func parsePSNumbers(s string) []float64 {
+	s = strings.Trim(strings.TrimSpace(s), "[]")
+	var values []float64
+	for _, field := range strings.Fields(s) {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// decodePDFString decode a pdf text string, which is either UTF-16BE with a BOM or PDFDocEncoding
+func decodePDFString(s string) string {
+	b := []byte(s)
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		units := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	return s
+}
+
+// readPDFVersion read the version from the %PDF-x.y header
+func readPDFVersion(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// The header may be preceded by junk within the first kilobyte
+	header := make([]byte, 1024)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	idx := bytes.Index(header[:n], []byte("%PDF-"))
+	if idx < 0 {
+		return "", fmt.Errorf("not a pdf file: %s", file)
+	}
+	version := header[idx+5 : min(idx+8, n)]
+	return strings.TrimSpace(string(version)), nil
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInspectOutput(t *testing.T) {
+	output := strings.Join([]string{
+		"PAGECOUNT\t2",
+		"ENCRYPTED\ttrue",
+		"INFO\tTitle\tQuarterly report",
+		"INFO\tProducer\t\xfe\xff\x00G\x00S",
+		"PAGE\t1\t[0 0 612 792]\t[]\t0",
+		"PAGE\t2\t[0 0 595.28 841.89]\t[10 10 585.28 831.89]\t-90",
+	}, "\n")
+
+	info := PdfInfo{Info: make(map[string]string)}
+	if err := parseInspectOutput([]byte(output), &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if info.PageCount != 2 {
+		t.Errorf("Expected page count 2, got %d", info.PageCount)
+	}
+	if !info.Encrypted {
+		t.Error("Expected the trailer encryption to be reported")
+	}
+	if info.Info["Title"] != "Quarterly report" || info.Info["Producer"] != "GS" {
+		t.Errorf("Unexpected info fields: %v", info.Info)
+	}
+	if len(info.Pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(info.Pages))
+	}
+	if !reflect.DeepEqual(info.Pages[0].CropBox, []float64{0, 0, 612, 792}) {
+		t.Errorf("Expected crop box to default to the media box, got %v", info.Pages[0].CropBox)
+	}
+	if info.Pages[1].Rotate != 270 {
+		t.Errorf("Expected rotation 270, got %d", info.Pages[1].Rotate)
+	}
+}
+
+func TestParseInspectOutputUnencrypted(t *testing.T) {
+	// A /Encrypt token in the content does not matter, only the trailer does
+	info := PdfInfo{Info: make(map[string]string)}
+	if err := parseInspectOutput([]byte("PAGECOUNT\t1\nENCRYPTED\tfalse\nINFO\tTitle\tThe /Encrypt key\n"), &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Encrypted {
+		t.Error("Expected a document without a trailer /Encrypt key to be unencrypted")
+	}
+}
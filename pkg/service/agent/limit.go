@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// fifoSemaphore counting semaphore granting slots in the order they were asked for
+type fifoSemaphore struct {
+	mu      sync.Mutex
+	free    int
+	waiters list.List // chan struct{} closed when the waiter is granted a slot
+}
+
+// newFIFOSemaphore semaphore with n slots
+func newFIFOSemaphore(n int) *fifoSemaphore {
+	return &fifoSemaphore{free: n}
+}
+
+// acquire wait for a slot behind every earlier caller, a nil semaphore never blocks
+func (s *fifoSemaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.free > 0 && s.waiters.Len() == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// The slot was handed over while giving up, pass it on
+			s.mu.Unlock()
+			s.release()
+		default:
+			s.waiters.Remove(elem)
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// release hand the slot to the longest waiting caller, or free it
+func (s *fifoSemaphore) release() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if front := s.waiters.Front(); front != nil {
+		s.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	s.free++
+}
+
+// ConcurrencyLimiter bounds the files processed at once, across all requests and within each one.
+// Requests queue in arrival order for the shared slots, and the per-request limit keeps one
+// large request from queuing ahead of everything that arrives after it.
+type ConcurrencyLimiter struct {
+	global     *fifoSemaphore
+	perRequest int
+}
+
+// NewConcurrencyLimiter limit processing to global files at once, at most perRequest of them
+// from the same request. A limit below 1 leaves that side unbounded, perRequest defaults to global.
+func NewConcurrencyLimiter(global, perRequest int) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{perRequest: perRequest}
+	if global > 0 {
+		l.global = newFIFOSemaphore(global)
+		if perRequest < 1 || perRequest > global {
+			l.perRequest = global
+		}
+	}
+	return l
+}
+
+// requestSemaphore semaphore for the files of a single request, nil when unbounded
+func (l *ConcurrencyLimiter) requestSemaphore() *fifoSemaphore {
+	if l == nil || l.perRequest < 1 {
+		return nil
+	}
+	return newFIFOSemaphore(l.perRequest)
+}
+
+// globalSemaphore semaphore shared by every request, nil when unbounded
+func (l *ConcurrencyLimiter) globalSemaphore() *fifoSemaphore {
+	if l == nil {
+		return nil
+	}
+	return l.global
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForWaiters block until n callers are queued on s
+func waitForWaiters(t *testing.T, s *fifoSemaphore, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		queued := s.waiters.Len()
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d waiters, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFIFOSemaphoreOrder(t *testing.T) {
+	s := newFIFOSemaphore(1)
+	ctx := context.Background()
+	if err := s.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			s.acquire(ctx)
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+			s.release()
+		}(i)
+		waitForWaiters(t, s, i+1)
+	}
+
+	s.release()
+	wg.Wait()
+	if expected := []int{0, 1, 2, 3}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected slots granted in order %v, got %v", expected, order)
+	}
+}
+
+func TestFIFOSemaphoreCancel(t *testing.T) {
+	s := newFIFOSemaphore(1)
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- s.acquire(ctx) }()
+	waitForWaiters(t, s, 1)
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Expected the cancelled waiter to give up, got %v", err)
+	}
+
+	// The slot must not be lost to the cancelled waiter
+	s.release()
+	if s.free != 1 || s.waiters.Len() != 0 {
+		t.Errorf("Expected 1 free slot and no waiters, got %d free and %d waiting", s.free, s.waiters.Len())
+	}
+}
+
+func TestForEachFileConcurrencyLimit(t *testing.T) {
+	testCases := []struct {
+		name       string
+		limiter    *ConcurrencyLimiter
+		maxRunning int32
+	}{
+		{name: "Global limit", limiter: NewConcurrencyLimiter(2, 0), maxRunning: 2},
+		{name: "Per request limit", limiter: NewConcurrencyLimiter(4, 1), maxRunning: 1},
+	}
+
+	files := []string{"a.pdf", "b.pdf", "c.pdf", "d.pdf", "e.pdf", "f.pdf"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &GhostscriptAgent{Limiter: tc.limiter}
+			var running, peak int32
+			outputs, err := g.forEachFile(context.Background(), files, func(file string, _ int) ([]string, error) {
+				now := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				return []string{file}, nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(outputs, files) {
+				t.Errorf("Expected outputs %v, got %v", files, outputs)
+			}
+			if peak > tc.maxRunning {
+				t.Errorf("Expected at most %d files at once, got %d", tc.maxRunning, peak)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsLinearized(t *testing.T) {
+	dir := t.TempDir()
+	body := "%%PDF-1.7\n1 0 obj\n<< /Linearized 1 /L %010d /H [ 600 150 ] /O 4 /E 900 /N 1 /T 1000 >>\nendobj\n"
+	length := len(fmt.Sprintf(body, 0))
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{name: "Linearized", content: fmt.Sprintf(body, length), expected: true},
+		{name: "Updated after linearization", content: fmt.Sprintf(body, length) + "2 0 obj\n<< >>\nendobj\n", expected: false},
+		{name: "Not linearized", content: "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(dir, "test.pdf")
+			if err := os.WriteFile(file, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			linearized, err := isLinearized(file)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if linearized != tc.expected {
+				t.Errorf("Expected linearized %v, got %v", tc.expected, linearized)
+			}
+		})
+	}
+}
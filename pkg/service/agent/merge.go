@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// mergePdf combine the input pdfs, in order, into a single pdf
+func (g *GhostscriptAgent) mergePdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF merge for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	outputName, err := outputFilenameParam(params, "merged.pdf", ".pdf")
+	if err != nil {
+		return nil, err
+	}
+
+	selections, err := filePagesParam(params, len(files))
+	if err != nil {
+		return nil, err
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve every selection before anything is written
+	pageLists := make([]string, len(files))
+	for i, file := range files {
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+
+		pages, err := selections[i].resolve(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		pageLists[i] = formatPageList(pages)
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+	outputFile := filepath.Join(outputDir, outputName)
+
+	// Switches apply to every file named after them, so each input gets its own PageList
+	args := append(pdfwriteArgs(outputFile), colorArgs...)
+	for i, file := range files {
+		args = append(args, fmt.Sprintf("-sPageList=%s", pageLists[i]))
+		args = append(args, inputFileArgs(params, file)...)
+	}
+
+	if _, err := g.runGhostscript(ctx, args); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF merge of %d files into %s in %v", len(files), outputFile, time.Since(startTime))
+
+	return []string{outputFile}, nil
+}
+
+// filePagesParam read the optional per-input page selections, aligned with the input files.
+// An empty or missing entry selects every page of that file.
+func filePagesParam(params map[string]interface{}, fileCount int) ([]pageSelection, error) {
+	selections := make([]pageSelection, fileCount)
+	for i := range selections {
+		selections[i] = pageSelection{{kind: pageTermAll}}
+	}
+
+	raw, ok := params["file_pages"]
+	if !ok || raw == nil {
+		return selections, nil
+	}
+
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, apperrors.NewInvalidParameterError("file_pages", "must be a list of page expressions")
+	}
+	if len(entries) > fileCount {
+		return nil, apperrors.NewInvalidParameterError("file_pages",
+			fmt.Sprintf("%d selections given for %d files", len(entries), fileCount))
+	}
+
+	for i, entry := range entries {
+		expr, ok := entry.(string)
+		if !ok {
+			return nil, apperrors.NewInvalidParameterError("file_pages", fmt.Sprintf("entry %d is not a string", i))
+		}
+		if expr == "" {
+			continue
+		}
+
+		selection, err := parsePageSelection(expr)
+		if err != nil {
+			return nil, err
+		}
+		selections[i] = selection
+	}
+
+	return selections, nil
+}
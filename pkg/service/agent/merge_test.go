@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilePagesParam(t *testing.T) {
+	testCases := []struct {
+		name        string
+		filePages   interface{}
+		expected    [][]int // pages of each of the 3 files, which have 4 pages each
+		expectError bool
+	}{
+		{name: "No selections", expected: [][]int{{1, 2, 3, 4}, {1, 2, 3, 4}, {1, 2, 3, 4}}},
+		{
+			name:      "Selection per file",
+			filePages: []interface{}{"1", "2-3", "odd"},
+			expected:  [][]int{{1}, {2, 3}, {1, 3}},
+		},
+		{
+			name:      "Missing file entry",
+			filePages: []interface{}{"last"},
+			expected:  [][]int{{4}, {1, 2, 3, 4}, {1, 2, 3, 4}},
+		},
+		{
+			name:      "Empty file entry",
+			filePages: []interface{}{"", "1-2"},
+			expected:  [][]int{{1, 2, 3, 4}, {1, 2}, {1, 2, 3, 4}},
+		},
+		{name: "Bad range", filePages: []interface{}{"1", "3-1"}, expectError: true},
+		{name: "More selections than files", filePages: []interface{}{"1", "2", "3", "4"}, expectError: true},
+		{name: "Not a list", filePages: "1-2", expectError: true},
+		{name: "Entry not a string", filePages: []interface{}{"1", 2}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := map[string]interface{}{}
+			if tc.filePages != nil {
+				params["file_pages"] = tc.filePages
+			}
+
+			selections, err := filePagesParam(params, 3)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pages := make([][]int, len(selections))
+			for i, selection := range selections {
+				if pages[i], err = selection.resolve(4); err != nil {
+					t.Fatalf("Unexpected error resolving file %d: %v", i+1, err)
+				}
+			}
+			if !reflect.DeepEqual(pages, tc.expected) {
+				t.Errorf("Expected pages %v, got %v", tc.expected, pages)
+			}
+		})
+	}
+}
+
+func TestMergePdfValidation(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.pdf")
+	if err := os.WriteFile(input, []byte("%PDF-1.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name             string
+		files            []string
+		params           map[string]interface{}
+		expectInvalidArg bool
+	}{
+		{name: "Missing file", files: []string{input, filepath.Join(dir, "missing.pdf")}, params: map[string]interface{}{}},
+		{
+			name:             "Selection count mismatch",
+			files:            []string{input},
+			params:           map[string]interface{}{"file_pages": []interface{}{"1", "1"}},
+			expectInvalidArg: true,
+		},
+		{
+			name:             "Bad output name",
+			files:            []string{input},
+			params:           map[string]interface{}{"output_filename": "../merged.pdf"},
+			expectInvalidArg: true,
+		},
+	}
+
+	g := &GhostscriptAgent{BinaryPath: "gs-not-run"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := g.mergePdf(context.Background(), tc.params, tc.files)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if apperrors.IsInvalidParameter(err) != tc.expectInvalidArg {
+				t.Errorf("Expected invalid parameter %v, got %v", tc.expectInvalidArg, err)
+			}
+		})
+	}
+}
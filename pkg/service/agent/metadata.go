@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/hex"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// pdfDate the start of a pdf date string, D:YYYY followed by optional finer fields
+var pdfDate = regexp.MustCompile(`^D:\d{4}`)
+
+// metadataOptions Info dictionary changes requested for updatePdfMetadata
+type metadataOptions struct {
+	strip  bool
+	fields map[string]string // by Info key, an empty value blanks the field
+}
+
+// parseMetadataOptions read the strip flag and the Info fields to set
+func parseMetadataOptions(params map[string]interface{}) (*metadataOptions, error) {
+	opts := &metadataOptions{fields: make(map[string]string)}
+	opts.strip, _ = params["strip"].(bool)
+
+	if raw, ok := params["info"]; ok && raw != nil {
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, apperrors.NewInvalidParameterError("info", "must map Info keys to strings")
+		}
+		for name, rawValue := range fields {
+			key := ""
+			for _, known := range pdfInfoKeys {
+				if strings.EqualFold(name, known) {
+					key = known
+				}
+			}
+			if key == "" {
+				return nil, apperrors.NewInvalidParameterError("info", fmt.Sprintf("unsupported Info key %q", name))
+			}
+			value, ok := rawValue.(string)
+			if !ok {
+				return nil, apperrors.NewInvalidParameterError("info", fmt.Sprintf("%s must be a string", key))
+			}
+			if isDateKey(key) && value != "" && !pdfDate.MatchString(value) {
+				return nil, apperrors.NewInvalidParameterError("info", fmt.Sprintf("%s must be a pdf date such as D:20240131120000Z", key))
+			}
+			opts.fields[key] = value
+		}
+	}
+
+	if !opts.strip && len(opts.fields) == 0 {
+		return nil, apperrors.NewInvalidParameterError("info", "nothing to change, give info fields or strip")
+	}
+	return opts, nil
+}
+
+// isDateKey report whether an Info key holds a date
+func isDateKey(key string) bool {
+	return key == "CreationDate" || key == "ModDate"
+}
+
+// switches pdfwrite switches dropping the XMP stream and the dates pdfwrite adds itself
+func (m metadataOptions) switches() []string {
+	if !m.strip {
+		return nil
+	}
+	args := []string{"-dOmitXMP"}
+	_, hasCreationDate := m.fields["CreationDate"]
+	_, hasModDate := m.fields["ModDate"]
+	if !hasCreationDate && !hasModDate {
+		args = append(args, "-dOmitInfoDate")
+	}
+	return args
+}
+
+// docInfoArgs arguments issuing the DOCINFO pdfmark. They must follow the input file,
+// as the interpreter copies the document's own Info when it opens it.
+func (m metadataOptions) docInfoArgs() []string {
+	var entries []string
+	for _, key := range pdfInfoKeys {
+		value, ok := m.fields[key]
+		if !ok && (!m.strip || isDateKey(key)) {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("/%s %s", key, pdfTextString(value)))
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return []string{"-c", fmt.Sprintf("[ %s /DOCINFO pdfmark", strings.Join(entries, " "))}
+}
+
+// pdfTextString quote s as a pdf text string, UTF-16BE with a byte order mark when it is not plain ASCII
+func pdfTextString(s string) string {
+	for _, r := range s {
+		if r > 0x7e || (r < 0x20 && r != '\t' && r != '\n' && r != '\r') {
+			encoded := []byte{0xfe, 0xff}
+			for _, unit := range utf16.Encode([]rune(s)) {
+				encoded = append(encoded, byte(unit>>8), byte(unit))
+			}
+			return "<" + hex.EncodeToString(encoded) + ">"
+		}
+	}
+	return psString(s)
+}
+
+// updatePdfMetadata strip or replace the Info dictionary and XMP metadata of the input pdfs
+func (g *GhostscriptAgent) updatePdfMetadata(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF metadata update for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	opts, err := parseMetadataOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		args := append(pdfwriteArgs(outputFile), opts.switches()...)
+		args = append(args, colorArgs...)
+		args = append(args, inputFileArgs(params, file)...)
+		args = append(args, opts.docInfoArgs()...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF metadata update for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
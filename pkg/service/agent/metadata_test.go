@@ -0,0 +1,68 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataOptions(t *testing.T) {
+	testCases := []struct {
+		name             string
+		params           map[string]interface{}
+		expectedSwitches []string
+		expectedInfo     []string
+		expectError      bool
+	}{
+		{
+			name:         "Set title",
+			params:       map[string]interface{}{"info": map[string]interface{}{"title": "Quarterly report"}},
+			expectedInfo: []string{"-c", "[ /Title (Quarterly report) /DOCINFO pdfmark"},
+		},
+		{
+			name:             "Strip",
+			params:           map[string]interface{}{"strip": true},
+			expectedSwitches: []string{"-dOmitXMP", "-dOmitInfoDate"},
+			expectedInfo:     []string{"-c", "[ /Title () /Author () /Subject () /Keywords () /Creator () /Producer () /DOCINFO pdfmark"},
+		},
+		{
+			name:             "Strip keeping a date",
+			params:           map[string]interface{}{"strip": true, "info": map[string]interface{}{"Author": "Ops", "ModDate": "D:20240131"}},
+			expectedSwitches: []string{"-dOmitXMP"},
+			expectedInfo:     []string{"-c", "[ /Title () /Author (Ops) /Subject () /Keywords () /Creator () /Producer () /ModDate (D:20240131) /DOCINFO pdfmark"},
+		},
+		{name: "Nothing to do", params: map[string]interface{}{}, expectError: true},
+		{name: "Unknown key", params: map[string]interface{}{"info": map[string]interface{}{"Owner": "x"}}, expectError: true},
+		{name: "Bad date", params: map[string]interface{}{"info": map[string]interface{}{"CreationDate": "2024-01-31"}}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseMetadataOptions(tc.params)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if switches := opts.switches(); !reflect.DeepEqual(switches, tc.expectedSwitches) {
+				t.Errorf("Expected switches %v, got %v", tc.expectedSwitches, switches)
+			}
+			if info := opts.docInfoArgs(); !reflect.DeepEqual(info, tc.expectedInfo) {
+				t.Errorf("Expected DOCINFO args %v, got %v", tc.expectedInfo, info)
+			}
+		})
+	}
+}
+
+func TestPdfTextString(t *testing.T) {
+	if got := pdfTextString("A (draft)"); got != `(A \(draft\))` {
+		t.Errorf("Unexpected ASCII string %s", got)
+	}
+	if got := pdfTextString("Zoë"); got != "<feff005a006f00eb>" {
+		t.Errorf("Unexpected unicode string %s", got)
+	}
+}
@@ -0,0 +1,351 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default grid, as columns and rows, for each supported number of pages per sheet
+var nupGrids = map[int][2]int{
+	2: {2, 1},
+	4: {2, 2},
+	6: {2, 3},
+	9: {3, 3},
+}
+
+// nupOptions layout of pages on each output sheet
+type nupOptions struct {
+	cols, rows int
+	margin     float64 // space around each page, in points
+	order      string  // ltr, rtl or ttb
+	booklet    bool
+}
+
+// parseNupOptions read the imposition parameters of nupPdf
+func parseNupOptions(params map[string]interface{}) (*nupOptions, error) {
+	opts := &nupOptions{order: "ltr"}
+
+	layout, _ := params["layout"].(string)
+	if layout == "" {
+		layout = "grid"
+	}
+	if layout != "grid" && layout != "booklet" {
+		return nil, apperrors.NewInvalidParameterError("layout", fmt.Sprintf("unsupported layout %q", layout))
+	}
+	opts.booklet = layout == "booklet"
+
+	if order, ok := params["reading_order"].(string); ok && order != "" {
+		opts.order = strings.ToLower(order)
+	}
+	switch {
+	case opts.order != "ltr" && opts.order != "rtl" && opts.order != "ttb":
+		return nil, apperrors.NewInvalidParameterError("reading_order", fmt.Sprintf("unsupported order %q", opts.order))
+	case opts.booklet && opts.order == "ttb":
+		return nil, apperrors.NewInvalidParameterError("reading_order", "booklets read ltr or rtl")
+	}
+
+	margin, err := marginParam(params)
+	if err != nil {
+		return nil, err
+	}
+	opts.margin = margin
+
+	perSheet, hasPerSheet, err := wholeNumberParam(params, "pages_per_sheet")
+	if err != nil {
+		return nil, err
+	}
+	grid, _ := params["grid"].(string)
+
+	if opts.booklet {
+		// Saddle stitching always puts two pages side by side on each sheet face
+		if (hasPerSheet && perSheet != 2) || grid != "" {
+			return nil, apperrors.NewInvalidParameterError("layout", "booklets always place 2 pages per sheet")
+		}
+		opts.cols, opts.rows = 2, 1
+		return opts, nil
+	}
+
+	if !hasPerSheet {
+		perSheet = 4
+	}
+	defaultGrid, ok := nupGrids[perSheet]
+	if !ok {
+		return nil, apperrors.NewInvalidParameterError("pages_per_sheet", "must be 2, 4, 6 or 9")
+	}
+	opts.cols, opts.rows = defaultGrid[0], defaultGrid[1]
+
+	if grid != "" {
+		cols, rows, err := parseGrid(grid)
+		if err != nil {
+			return nil, err
+		}
+		if cols*rows != perSheet {
+			return nil, apperrors.NewInvalidParameterError("grid",
+				fmt.Sprintf("%s does not hold %d pages per sheet", grid, perSheet))
+		}
+		opts.cols, opts.rows = cols, rows
+	}
+
+	return opts, nil
+}
+
+// marginParam read the optional margin in points
+func marginParam(params map[string]interface{}) (float64, error) {
+	raw, ok := params["margin"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	margin, ok := raw.(float64)
+	if !ok || margin < 0 || margin > 144 {
+		return 0, apperrors.NewInvalidParameterError("margin", "must be between 0 and 144 points")
+	}
+	return margin, nil
+}
+
+// parseGrid parse a COLUMNSxROWS grid
+func parseGrid(grid string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(grid), "x")
+	if len(parts) != 2 {
+		return 0, 0, apperrors.NewInvalidParameterError("grid", fmt.Sprintf("invalid grid %q, expected COLUMNSxROWS", grid))
+	}
+	cols, colsErr := strconv.Atoi(strings.TrimSpace(parts[0]))
+	rows, rowsErr := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if colsErr != nil || rowsErr != nil || cols < 1 || rows < 1 {
+		return 0, 0, apperrors.NewInvalidParameterError("grid", fmt.Sprintf("invalid grid %q, expected COLUMNSxROWS", grid))
+	}
+	return cols, rows, nil
+}
+
+// sequence order the selected pages the way ghostscript fills the grid, row by row
+// from the top left. 0 marks a blank cell.
+func (n nupOptions) sequence(pages []int) []int {
+	var seq []int
+	if n.booklet {
+		seq = bookletSequence(pages, n.order == "rtl")
+	} else {
+		seq = gridSequence(pages, n.cols, n.rows, n.order)
+	}
+
+	// Ghostscript flushes the last partial sheet itself
+	for len(seq) > 0 && seq[len(seq)-1] == 0 {
+		seq = seq[:len(seq)-1]
+	}
+	return seq
+}
+
+// gridSequence place pages on sheets of cols x rows cells in the given reading order
+func gridSequence(pages []int, cols, rows int, order string) []int {
+	perSheet := cols * rows
+	sheets := (len(pages) + perSheet - 1) / perSheet
+	seq := make([]int, sheets*perSheet)
+	for i, page := range pages {
+		sheet, cell := i/perSheet, i%perSheet
+		row, col := cell/cols, cell%cols
+		switch order {
+		case "rtl":
+			col = cols - 1 - col
+		case "ttb":
+			row, col = cell%rows, cell/rows
+		}
+		seq[sheet*perSheet+row*cols+col] = page
+	}
+	return seq
+}
+
+// bookletSequence impose pages for saddle stitching, padded with blanks to a multiple of four.
+// Each sheet contributes its front then its back, two pages per face.
+func bookletSequence(pages []int, rtl bool) []int {
+	n := (len(pages) + 3) / 4 * 4
+	padded := make([]int, n)
+	copy(padded, pages)
+
+	seq := make([]int, 0, n)
+	for i := 0; i < n/2; i += 2 {
+		front := [2]int{padded[n-1-i], padded[i]}
+		back := [2]int{padded[i+1], padded[n-2-i]}
+		if rtl {
+			front[0], front[1] = front[1], front[0]
+			back[0], back[1] = back[1], back[0]
+		}
+		seq = append(seq, front[0], front[1], back[0], back[1])
+	}
+	return seq
+}
+
+// sequenceArgs input arguments feeding the pages of seq, in order, from file and from a one page blank file
+func sequenceArgs(seq []int, file, blankFile string) []string {
+	var args []string
+	for start := 0; start < len(seq); {
+		end := start
+		for end < len(seq) && (seq[end] == 0) == (seq[start] == 0) {
+			end++
+		}
+
+		if seq[start] == 0 {
+			args = append(args, "-sPageList=1")
+			for i := start; i < end; i++ {
+				args = append(args, blankFile)
+			}
+		} else {
+			pageList := make([]string, 0, end-start)
+			for _, page := range seq[start:end] {
+				pageList = append(pageList, strconv.Itoa(page))
+			}
+			args = append(args, fmt.Sprintf("-sPageList=%s", strings.Join(pageList, ",")), file)
+		}
+		start = end
+	}
+	return args
+}
+
+// writeBlankPdf write a pdf holding a single empty page of the given size in points
+func writeBlankPdf(path string, width, height float64) error {
+	doc, err := createPdfDocument(path)
+	if err != nil {
+		return err
+	}
+
+	catalog, pages, page := doc.newObject(), doc.newObject(), doc.newObject()
+	doc.writeObject(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	doc.writeObject(pages, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", page))
+	doc.writeObject(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] >>",
+		pages, formatPSNumber(width), formatPSNumber(height)))
+	return doc.close(catalog)
+}
+
+// nupPdf lay out several pages per sheet, as a grid or as a saddle stitched booklet
+func (g *GhostscriptAgent) nupPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF n-up imposition for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	opts, err := parseNupOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, _ := params["pages"].(string)
+	if pages == "" {
+		pages = "all"
+	}
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sheets default to the page size times the grid, unless a paper size is given
+	var sheetArgs []string
+	size, err := optionalPaperSizeParam(params)
+	if err != nil {
+		return nil, err
+	}
+	if size != nil {
+		sheetArgs = []string{
+			fmt.Sprintf("-dDEVICEWIDTHPOINTS=%s", formatPSNumber(size[0])),
+			fmt.Sprintf("-dDEVICEHEIGHTPOINTS=%s", formatPSNumber(size[1])),
+			"-dFIXEDMEDIA",
+		}
+	}
+
+	// Colors are converted once, when the sheets are written
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	sheetArgs = append(sheetArgs, colorArgs...)
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		info, err := g.inspectFile(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		selectedPages, err := selection.resolve(info.PageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		// Blank cells and margins are sized after the first selected page
+		if len(info.Pages) < selectedPages[0] {
+			return nil, fmt.Errorf("%s: missing size of page %d", file, selectedPages[0])
+		}
+		width, height := info.Pages[selectedPages[0]-1].pageSize()
+		inputArgs := inputFileArgs(params, file)
+		inputFile := file
+
+		if opts.margin > 0 {
+			width, height = width+2*opts.margin, height+2*opts.margin
+			inputFile = filepath.Join(fileOutputDir, baseNameWithoutExt+"_margin.pdf")
+			defer os.Remove(inputFile)
+
+			// Grow every page by the margin and shift its content into the middle
+			marginArgs := append(pdfwriteArgs(inputFile),
+				fmt.Sprintf("-dDEVICEWIDTHPOINTS=%s", formatPSNumber(width)),
+				fmt.Sprintf("-dDEVICEHEIGHTPOINTS=%s", formatPSNumber(height)),
+				"-dFIXEDMEDIA",
+				"-c", fmt.Sprintf("<< /BeginPage { pop %s %s translate } bind >> setpagedevice",
+					formatPSNumber(opts.margin), formatPSNumber(opts.margin)),
+				"-f",
+			)
+			marginArgs = append(marginArgs, inputArgs...)
+			if _, err := g.runGhostscript(ctx, marginArgs); err != nil {
+				return nil, err
+			}
+		}
+
+		seq := opts.sequence(selectedPages)
+		blankFile := filepath.Join(fileOutputDir, baseNameWithoutExt+"_blank.pdf")
+		if err := writeBlankPdf(blankFile, width, height); err != nil {
+			return nil, fmt.Errorf("failed to write blank page for %s: %v", file, err)
+		}
+		defer os.Remove(blankFile)
+
+		args := append(pdfwriteArgs(outputFile), sheetArgs...)
+		args = append(args, fmt.Sprintf("-sNupControl=%dx%d", opts.cols, opts.rows))
+		if inputFile == file {
+			// Only the original input may need its password
+			args = append(args, inputArgs[:len(inputArgs)-1]...)
+		}
+		args = append(args, sequenceArgs(seq, inputFile, blankFile)...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF n-up imposition for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
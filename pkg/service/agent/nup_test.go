@@ -0,0 +1,80 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"reflect"
+	"testing"
+)
+
+func TestNupSequence(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     nupOptions
+		pages    []int
+		expected []int
+	}{
+		{name: "Grid ltr", opts: nupOptions{cols: 2, rows: 2, order: "ltr"}, pages: []int{1, 2, 3, 4, 5}, expected: []int{1, 2, 3, 4, 5}},
+		{name: "Grid rtl", opts: nupOptions{cols: 2, rows: 2, order: "rtl"}, pages: []int{1, 2, 3}, expected: []int{2, 1, 0, 3}},
+		{name: "Grid ttb", opts: nupOptions{cols: 2, rows: 3, order: "ttb"}, pages: []int{1, 2, 3, 4, 5, 6}, expected: []int{1, 4, 2, 5, 3, 6}},
+		{name: "Booklet", opts: nupOptions{cols: 2, rows: 1, order: "ltr", booklet: true}, pages: []int{1, 2, 3, 4, 5, 6, 7, 8},
+			expected: []int{8, 1, 2, 7, 6, 3, 4, 5}},
+		{name: "Booklet padded", opts: nupOptions{cols: 2, rows: 1, order: "ltr", booklet: true}, pages: []int{1, 2, 3},
+			expected: []int{0, 1, 2, 3}},
+		{name: "Booklet rtl", opts: nupOptions{cols: 2, rows: 1, order: "rtl", booklet: true}, pages: []int{1, 2, 3, 4},
+			expected: []int{1, 4, 3, 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seq := tc.opts.sequence(tc.pages)
+			if !reflect.DeepEqual(seq, tc.expected) {
+				t.Errorf("Expected sequence %v, got %v", tc.expected, seq)
+			}
+		})
+	}
+}
+
+func TestParseNupOptions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		params       map[string]interface{}
+		expectedCols int
+		expectedRows int
+		expectError  bool
+	}{
+		{name: "Default", params: map[string]interface{}{}, expectedCols: 2, expectedRows: 2},
+		{name: "Six up", params: map[string]interface{}{"pages_per_sheet": 6.0}, expectedCols: 2, expectedRows: 3},
+		{name: "Custom grid", params: map[string]interface{}{"pages_per_sheet": 6.0, "grid": "3x2"}, expectedCols: 3, expectedRows: 2},
+		{name: "Booklet", params: map[string]interface{}{"layout": "booklet"}, expectedCols: 2, expectedRows: 1},
+		{name: "Unsupported count", params: map[string]interface{}{"pages_per_sheet": 5.0}, expectError: true},
+		{name: "Grid mismatch", params: map[string]interface{}{"pages_per_sheet": 4.0, "grid": "3x3"}, expectError: true},
+		{name: "Booklet ttb", params: map[string]interface{}{"layout": "booklet", "reading_order": "ttb"}, expectError: true},
+		{name: "Negative margin", params: map[string]interface{}{"margin": -1.0}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseNupOptions(tc.params)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if opts.cols != tc.expectedCols || opts.rows != tc.expectedRows {
+				t.Errorf("Expected %dx%d grid, got %dx%d", tc.expectedCols, tc.expectedRows, opts.cols, opts.rows)
+			}
+		})
+	}
+}
+
+func TestSequenceArgs(t *testing.T) {
+	args := sequenceArgs([]int{4, 1, 0, 0, 2}, "in.pdf", "blank.pdf")
+	expected := []string{"-sPageList=4,1", "in.pdf", "-sPageList=1", "blank.pdf", "blank.pdf", "-sPageList=2", "in.pdf"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, args)
+	}
+}
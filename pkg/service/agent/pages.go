@@ -0,0 +1,182 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pageTermKind kind of a single term in a page range expression
+type pageTermKind int
+
+const (
+	pageTermRange pageTermKind = iota
+	pageTermAll
+	pageTermOdd
+	pageTermEven
+	pageTermLast
+)
+
+// pageTerm single comma separated term of a page range expression
+type pageTerm struct {
+	kind  pageTermKind
+	first int
+	last  int // 0 means up to the last page of the document
+}
+
+// defaultContentPages pages convertPdfToImage and extractText read when no pages are given,
+// just the first so a bare request stays cheap on long documents
+const defaultContentPages = "1"
+
+// pageSelection parsed page range expression such as "1-3,7,10-"
+type pageSelection []pageTerm
+
+// parsePageSelection parse a page range expression.
+// Supported terms are "all", "odd", "even", "last", "N", "N-M", "N-" and "N-last",
+// combined with commas.
+func parsePageSelection(expr string) (pageSelection, error) {
+	expr = strings.TrimSpace(strings.ToLower(expr))
+	if expr == "" {
+		return nil, apperrors.NewInvalidParameterError("pages", "empty page expression")
+	}
+
+	var selection pageSelection
+	for _, raw := range strings.Split(expr, ",") {
+		token := strings.TrimSpace(raw)
+		switch token {
+		case "":
+			return nil, apperrors.NewInvalidParameterError("pages", fmt.Sprintf("empty term in %q", expr))
+		case "all":
+			selection = append(selection, pageTerm{kind: pageTermAll})
+			continue
+		case "odd":
+			selection = append(selection, pageTerm{kind: pageTermOdd})
+			continue
+		case "even":
+			selection = append(selection, pageTerm{kind: pageTermEven})
+			continue
+		case "last":
+			selection = append(selection, pageTerm{kind: pageTermLast})
+			continue
+		}
+
+		firstStr, lastStr, isRange := strings.Cut(token, "-")
+		first, err := parsePageNumber(firstStr)
+		if err != nil {
+			return nil, err
+		}
+
+		last := first
+		if isRange {
+			lastStr = strings.TrimSpace(lastStr)
+			switch lastStr {
+			case "", "last":
+				last = 0
+			default:
+				if last, err = parsePageNumber(lastStr); err != nil {
+					return nil, err
+				}
+				if last < first {
+					return nil, apperrors.NewInvalidParameterError("pages", fmt.Sprintf("descending range %q", token))
+				}
+			}
+		}
+
+		selection = append(selection, pageTerm{kind: pageTermRange, first: first, last: last})
+	}
+
+	return selection, nil
+}
+
+// parsePageNumber parse a single 1-based page number
+func parsePageNumber(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, apperrors.NewInvalidParameterError("pages", fmt.Sprintf("invalid page number %q", s))
+	}
+	return n, nil
+}
+
+// resolve validate the selection against the document page count and
+// return the selected pages in ascending order without duplicates
+func (s pageSelection) resolve(pageCount int) ([]int, error) {
+	if pageCount < 1 {
+		return nil, apperrors.NewInvalidParameterError("pages", "document has no pages")
+	}
+
+	selected := make(map[int]bool)
+	for _, term := range s {
+		switch term.kind {
+		case pageTermAll:
+			for p := 1; p <= pageCount; p++ {
+				selected[p] = true
+			}
+		case pageTermOdd:
+			for p := 1; p <= pageCount; p += 2 {
+				selected[p] = true
+			}
+		case pageTermEven:
+			for p := 2; p <= pageCount; p += 2 {
+				selected[p] = true
+			}
+		case pageTermLast:
+			selected[pageCount] = true
+		case pageTermRange:
+			last := term.last
+			if last == 0 {
+				last = pageCount
+			}
+			if term.first > pageCount || last > pageCount {
+				return nil, apperrors.NewInvalidParameterError("pages",
+					fmt.Sprintf("page %d out of range, document has %d pages", max(term.first, last), pageCount))
+			}
+			for p := term.first; p <= last; p++ {
+				selected[p] = true
+			}
+		}
+	}
+
+	pages := make([]int, 0, len(selected))
+	for p := range selected {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+	return pages, nil
+}
+
+// formatPageList format pages as a ghostscript PageList, collapsing runs into ranges
+func formatPageList(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(pages[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageSelectionArgs ghostscript arguments selecting pages out of a document with pageCount pages
+func pageSelectionArgs(pages []int, pageCount int) []string {
+	switch {
+	case len(pages) == pageCount:
+		return nil
+	case pages[len(pages)-1]-pages[0] == len(pages)-1:
+		// A single contiguous run
+		return []string{
+			fmt.Sprintf("-dFirstPage=%d", pages[0]),
+			fmt.Sprintf("-dLastPage=%d", pages[len(pages)-1]),
+		}
+	default:
+		return []string{fmt.Sprintf("-sPageList=%s", formatPageList(pages))}
+	}
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"reflect"
+	"testing"
+)
+
+func TestPageSelection(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expr        string
+		pageCount   int
+		expected    []int
+		expectError bool
+	}{
+		{name: "Single page", expr: "2", pageCount: 5, expected: []int{2}},
+		{name: "All pages", expr: "all", pageCount: 3, expected: []int{1, 2, 3}},
+		{name: "Mixed ranges", expr: "1-3,7,10-", pageCount: 12, expected: []int{1, 2, 3, 7, 10, 11, 12}},
+		{name: "Odd pages", expr: "odd", pageCount: 5, expected: []int{1, 3, 5}},
+		{name: "Even pages", expr: "even", pageCount: 5, expected: []int{2, 4}},
+		{name: "Last page", expr: "last", pageCount: 9, expected: []int{9}},
+		{name: "Range to last", expr: "4-last", pageCount: 5, expected: []int{4, 5}},
+		{name: "Overlapping terms", expr: "1-3, 2, odd", pageCount: 5, expected: []int{1, 2, 3, 5}},
+		{name: "Page out of range", expr: "6", pageCount: 5, expectError: true},
+		{name: "Open range out of range", expr: "6-", pageCount: 5, expectError: true},
+		{name: "Descending range", expr: "3-1", pageCount: 5, expectError: true},
+		{name: "Zero page", expr: "0", pageCount: 5, expectError: true},
+		{name: "Garbage", expr: "1;rm -rf", pageCount: 5, expectError: true},
+		{name: "Empty term", expr: "1,,2", pageCount: 5, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selection, err := parsePageSelection(tc.expr)
+			var pages []int
+			if err == nil {
+				pages, err = selection.resolve(tc.pageCount)
+			}
+
+			if tc.expectError {
+				if err == nil {
+					t.Fatalf("Expected error but got pages %v", pages)
+				}
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected ErrInvalidParameter, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(pages, tc.expected) {
+				t.Errorf("Expected pages %v, got %v", tc.expected, pages)
+			}
+		})
+	}
+}
+
+func TestPageSelectionArgs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		pages     []int
+		pageCount int
+		expected  []string
+	}{
+		{name: "All pages", pages: []int{1, 2, 3}, pageCount: 3, expected: nil},
+		{name: "Contiguous run", pages: []int{2, 3, 4}, pageCount: 5, expected: []string{"-dFirstPage=2", "-dLastPage=4"}},
+		{name: "Page list", pages: []int{1, 2, 3, 7, 10, 11}, pageCount: 11, expected: []string{"-sPageList=1-3,7,10-11"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := pageSelectionArgs(tc.pages, tc.pageCount)
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("Expected args %v, got %v", tc.expected, args)
+			}
+		})
+	}
+}
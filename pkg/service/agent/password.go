@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// passwordSwitch ghostscript switch carrying the password of the files that follow it
+const passwordSwitch = "-sPDFPassword="
+
+// permitReadSwitch ghostscript switch granting a program read access to a file past -dSAFER
+const permitReadSwitch = "--permit-file-read="
+
+// Switches whose values are masked in logs
+var secretSwitches = []string{
+	passwordSwitch,
+	"-sOwnerPassword=",
+	"-sUserPassword=",
+}
+
+// Ghostscript messages reporting a missing or wrong password
+var passwordFailureMessages = [][]byte{
+	[]byte("requires a password"),
+	[]byte("Password did not work"),
+}
+
+// passwordFor password to open file with, a per-file entry in "passwords" wins over "password"
+func passwordFor(params map[string]interface{}, file string) string {
+	if passwords, ok := params["passwords"].(map[string]interface{}); ok {
+		if password, ok := passwords[file].(string); ok && password != "" {
+			return password
+		}
+	}
+	password, _ := params["password"].(string)
+	return password
+}
+
+// inputFileArgs ghostscript arguments naming an input file, preceded by its password or EPS crop switch if any
+func inputFileArgs(params map[string]interface{}, file string) []string {
+	if isPostScript(file) {
+		// EPS renders to its bounding box rather than to a full page
+		if isEPS(file) {
+			return []string{"-dEPSCrop", file}
+		}
+		return []string{file}
+	}
+	if password := passwordFor(params, file); password != "" {
+		return []string{passwordSwitch + password, file}
+	}
+	return []string{file}
+}
+
+// redactArgs copy of args with every password value masked, for logging
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		for _, secret := range secretSwitches {
+			if strings.HasPrefix(arg, secret) {
+				arg = secret + "***"
+			}
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// isPasswordFailure check ghostscript output for a missing or wrong password
+func isPasswordFailure(output []byte) bool {
+	for _, message := range passwordFailureMessages {
+		if bytes.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordError typed error for a password failure, depending on whether a password was given,
+// naming the documents it may concern
+func passwordError(args []string) error {
+	var unlocked, locked, readable []string
+	withPassword := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-c":
+			// Skip the PostScript program up to the next -f
+			for i+1 < len(args) && args[i+1] != "-f" {
+				i++
+			}
+		case strings.HasPrefix(arg, permitReadSwitch):
+			readable = append(readable, filepath.Base(strings.TrimPrefix(arg, permitReadSwitch)))
+		case strings.HasPrefix(arg, passwordSwitch):
+			withPassword = arg != passwordSwitch
+		case strings.HasPrefix(arg, "-") || isPostScript(arg):
+		case withPassword:
+			locked = append(locked, filepath.Base(arg))
+			withPassword = false
+		default:
+			unlocked = append(unlocked, filepath.Base(arg))
+		}
+	}
+
+	// Programs like the page count open the document themselves, it is only named by the read permission
+	if len(locked) == 0 && len(unlocked) == 0 {
+		if withPassword {
+			locked = readable
+		} else {
+			unlocked = readable
+		}
+	}
+
+	// Only the documents given a password can have a wrong one
+	if len(locked) > 0 {
+		return fmt.Errorf("%s: %w", strings.Join(locked, ", "), apperrors.ErrInvalidPassword)
+	}
+	return fmt.Errorf("%s: %w", strings.Join(unlocked, ", "), apperrors.ErrPasswordRequired)
+}
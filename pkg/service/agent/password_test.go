@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"errors"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInputFileArgs(t *testing.T) {
+	params := map[string]interface{}{
+		"password": "shared",
+		"passwords": map[string]interface{}{
+			"b.pdf": "secret-b",
+		},
+	}
+
+	if args := inputFileArgs(params, "a.pdf"); !reflect.DeepEqual(args, []string{"-sPDFPassword=shared", "a.pdf"}) {
+		t.Errorf("Expected shared password for a.pdf, got %v", args)
+	}
+	if args := inputFileArgs(params, "b.pdf"); !reflect.DeepEqual(args, []string{"-sPDFPassword=secret-b", "b.pdf"}) {
+		t.Errorf("Expected per-file password for b.pdf, got %v", args)
+	}
+	if args := inputFileArgs(map[string]interface{}{}, "c.pdf"); !reflect.DeepEqual(args, []string{"c.pdf"}) {
+		t.Errorf("Expected no password switch, got %v", args)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"-dSAFER", "-sPDFPassword=hunter2", "-sOwnerPassword=owner1", "-sUserPassword=user1", "in.pdf"}
+	redacted := strings.Join(redactArgs(args), " ")
+	if strings.Contains(redacted, "hunter2") || strings.Contains(redacted, "owner1") || strings.Contains(redacted, "user1") {
+		t.Errorf("Password leaked into %q", redacted)
+	}
+	if args[1] != "-sPDFPassword=hunter2" {
+		t.Error("Expected original args to be left untouched")
+	}
+}
+
+func TestPasswordError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		args          []string
+		expectedErr   error
+		expectedFiles string
+	}{
+		{name: "No password", args: []string{"-dSAFER", "/tmp/in/report.pdf"}, expectedErr: apperrors.ErrPasswordRequired, expectedFiles: "report.pdf"},
+		{name: "Wrong password", args: []string{"-sPDFPassword=wrong", "/tmp/in/report.pdf"}, expectedErr: apperrors.ErrInvalidPassword, expectedFiles: "report.pdf"},
+		{
+			name:          "Wrong password among several files",
+			args:          []string{"/tmp/in/a.pdf", "-sPDFPassword=wrong", "/tmp/in/b.pdf", "/tmp/in/c.pdf"},
+			expectedErr:   apperrors.ErrInvalidPassword,
+			expectedFiles: "b.pdf",
+		},
+		{
+			name:          "Program and prelude arguments",
+			args:          []string{"/tmp/out/stamp.ps", "-c", "<< >> setpagedevice", "-f", "/tmp/in/report.pdf", "-c", "[ /DOCINFO pdfmark"},
+			expectedErr:   apperrors.ErrPasswordRequired,
+			expectedFiles: "report.pdf",
+		},
+		{
+			name: "Page count with a wrong password",
+			args: []string{"-q", "-dNODISPLAY", "-dNOPAUSE", "-dBATCH", "-dSAFER", "--permit-file-read=/tmp/in/report.pdf",
+				"-sPDFPassword=wrong", "-c", "(/tmp/in/report.pdf) (r) file runpdfbegin pdfpagecount ="},
+			expectedErr:   apperrors.ErrInvalidPassword,
+			expectedFiles: "report.pdf",
+		},
+		{
+			name: "Inspection without a password",
+			args: []string{"-q", "-dNODISPLAY", "-dNOPAUSE", "-dBATCH", "-dSAFER", "--permit-file-read=/tmp/in/report.pdf",
+				"-c", "(/tmp/in/report.pdf)" + fmt.Sprintf(pdfInspectProgram, "/Title")},
+			expectedErr:   apperrors.ErrPasswordRequired,
+			expectedFiles: "report.pdf",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := passwordError(tc.args)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+			}
+			if expected := tc.expectedFiles + ": " + tc.expectedErr.Error(); err.Error() != expected {
+				t.Errorf("Expected %q, got %q", expected, err.Error())
+			}
+		})
+	}
+
+	if !isPasswordFailure([]byte("   **** Error: Password did not work.\n")) {
+		t.Error("Expected ghostscript password message to be recognised")
+	}
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// pdfDocument minimal pdf writer streaming numbered objects straight to a file
+type pdfDocument struct {
+	f       *os.File
+	w       *bufio.Writer
+	offset  int
+	offsets []int // byte offset of each object, indexed by object number - 1
+}
+
+// createPdfDocument start a new pdf at path
+func createPdfDocument(path string) (*pdfDocument, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &pdfDocument{f: f, w: bufio.NewWriter(f)}
+	d.write([]byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"))
+	return d, nil
+}
+
+// write append raw bytes, write errors are reported by close
+func (d *pdfDocument) write(p []byte) {
+	n, _ := d.w.Write(p)
+	d.offset += n
+}
+
+// newObject reserve the next object number, so objects can refer to each other before being written
+func (d *pdfDocument) newObject() int {
+	d.offsets = append(d.offsets, 0)
+	return len(d.offsets)
+}
+
+// writeObject write a reserved object
+func (d *pdfDocument) writeObject(num int, body string) {
+	d.offsets[num-1] = d.offset
+	d.write([]byte(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", num, body)))
+}
+
+// writeStream write a reserved stream object, dict holds the entries besides /Length
+func (d *pdfDocument) writeStream(num int, dict string, data []byte) {
+	d.offsets[num-1] = d.offset
+	if dict != "" {
+		dict += " "
+	}
+	d.write([]byte(fmt.Sprintf("%d 0 obj\n<< %s/Length %d >>\nstream\n", num, dict, len(data))))
+	d.write(data)
+	d.write([]byte("\nendstream\nendobj\n"))
+}
+
+// close write the cross reference table and the trailer pointing at the root catalog
+func (d *pdfDocument) close(root int) error {
+	xref := d.offset
+	d.write([]byte(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(d.offsets)+1)))
+	for _, offset := range d.offsets {
+		d.write([]byte(fmt.Sprintf("%010d 00000 n \n", offset)))
+	}
+	d.write([]byte(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.offsets)+1, root, xref)))
+
+	if err := d.w.Flush(); err != nil {
+		d.f.Close()
+		return err
+	}
+	return d.f.Close()
+}
+
+// abort close the file of a document that will not be finished
+func (d *pdfDocument) abort() {
+	d.f.Close()
+}
+
+// pdfNumber format a number for pdf content, rounded to a thousandth of a point
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lines a worker prints around each job so its output can be told apart from the next one
+const (
+	jobDoneMarker   = "FHA_JOB_DONE"
+	jobFailedMarker = "FHA_JOB_FAILED"
+)
+
+// Switches every pooled interpreter already runs with
+var workerSwitches = map[string]bool{
+	"-q":          true,
+	"-dNOPAUSE":   true,
+	"-dBATCH":     true,
+	"-dSAFER":     true,
+	"-dNODISPLAY": true,
+}
+
+// Switches a job defines for the interpreter, which reads them while running the document
+var jobInterpreterParams = map[string]bool{
+	"FirstPage":   true,
+	"LastPage":    true,
+	"PageList":    true,
+	"PDFPassword": true,
+}
+
+// Switches a job hands to the device through setpagedevice
+var jobDeviceParams = map[string]bool{
+	"OutputFile":         true,
+	"DownScaleFactor":    true,
+	"JPEGQ":              true,
+	"TextAlphaBits":      true,
+	"GraphicsAlphaBits":  true,
+	"Compression":        true,
+	"OutputICCProfile":   true,
+	"DefaultRGBProfile":  true,
+	"DefaultCMYKProfile": true,
+	"DefaultGrayProfile": true,
+	"RenderIntent":       true,
+	"BlackPtComp":        true,
+}
+
+// GhostscriptPool persistent ghostscript interpreters running jobs sent over stdin,
+// so small documents do not pay for a process start each. Jobs the pool cannot
+// express, or that touch files outside its directories, run as separate processes.
+type GhostscriptPool struct {
+	binaryPath string
+	maxJobs    int      // jobs a worker runs before it is replaced
+	readDirs   []string // directories jobs may read from
+	writeDirs  []string // directories jobs may write to
+
+	slots      chan struct{}  // one per running worker, bounds the pool size
+	idle       chan *gsWorker // started workers waiting for a job
+	newCommand func(name string, args ...string) *exec.Cmd
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// gsWorker one interpreter in job server mode
+type gsWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	pipe   *os.File
+	output *bufio.Reader
+	jobs   int
+}
+
+// NewGhostscriptPool create a pool of at most size interpreters, each replaced after maxJobs jobs.
+// Jobs may read from readDirs and write to writeDirs, which are also readable.
+func NewGhostscriptPool(binaryPath string, size, maxJobs int, readDirs, writeDirs []string) *GhostscriptPool {
+	if size < 1 {
+		size = 1
+	}
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+	return &GhostscriptPool{
+		binaryPath: binaryPath,
+		maxJobs:    maxJobs,
+		readDirs:   absDirs(append(append([]string{}, readDirs...), writeDirs...)),
+		writeDirs:  absDirs(writeDirs),
+		slots:      make(chan struct{}, size),
+		idle:       make(chan *gsWorker, size),
+		newCommand: exec.Command,
+	}
+}
+
+// absDirs absolute form of each directory, skipping empty entries
+func absDirs(dirs []string) []string {
+	var abs []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if path, err := filepath.Abs(dir); err == nil {
+			abs = append(abs, path)
+		}
+	}
+	return abs
+}
+
+// withinDirs report whether path lies inside one of dirs
+func withinDirs(path string, dirs []string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// job translate command line arguments into a PostScript job, false when they need a process of their own
+func (p *GhostscriptPool) job(args []string) (string, bool) {
+	var device string
+	var interpreter, deviceParams, body []string
+	var hasInput bool
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case workerSwitches[arg]:
+		case strings.HasPrefix(arg, "--permit-file-read="):
+			if !withinDirs(strings.TrimPrefix(arg, "--permit-file-read="), p.readDirs) {
+				return "", false
+			}
+		case strings.HasPrefix(arg, "-sDEVICE="):
+			device = strings.TrimPrefix(arg, "-sDEVICE=")
+		case strings.HasPrefix(arg, "-r"):
+			res := strings.SplitN(strings.TrimPrefix(arg, "-r"), "x", 2)
+			if len(res) == 1 {
+				res = append(res, res[0])
+			}
+			deviceParams = append(deviceParams, fmt.Sprintf("/HWResolution [%s %s]", res[0], res[1]))
+		case arg == "-c":
+			// Programs that end the interpreter cannot run inside a job
+			for i+1 < len(args) && args[i+1] != "-f" {
+				i++
+				if strings.Contains(args[i], "quit") {
+					return "", false
+				}
+				body = append(body, args[i])
+			}
+		case arg == "-f":
+		case strings.HasPrefix(arg, "-d") || strings.HasPrefix(arg, "-s"):
+			name, value, ok := strings.Cut(arg[2:], "=")
+			if !ok {
+				return "", false
+			}
+			psValue := psString(value)
+			if arg[1] == 'd' {
+				psValue = value
+			}
+			switch {
+			case name == "OutputFile":
+				if value != "%stdout" && !withinDirs(value, p.writeDirs) {
+					return "", false
+				}
+				deviceParams = append(deviceParams, fmt.Sprintf("/OutputFile %s", psValue))
+			case jobDeviceParams[name]:
+				if strings.HasSuffix(name, "Profile") && !withinDirs(value, p.readDirs) {
+					return "", false
+				}
+				deviceParams = append(deviceParams, fmt.Sprintf("/%s %s", name, psValue))
+			case jobInterpreterParams[name]:
+				interpreter = append(interpreter, fmt.Sprintf("/%s %s def", name, psValue))
+			default:
+				return "", false
+			}
+		case strings.HasPrefix(arg, "-"):
+			return "", false
+		default:
+			if !withinDirs(arg, p.readDirs) {
+				return "", false
+			}
+			body = append(body, fmt.Sprintf("%s run", psString(arg)))
+			hasInput = true
+		}
+	}
+	if !hasInput && len(body) == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, def := range interpreter {
+		b.WriteString(def + "\n")
+	}
+	if device != "" {
+		fmt.Fprintf(&b, "%s selectdevice\n", psString(device))
+	} else {
+		b.WriteString("nulldevice\n")
+	}
+	if len(deviceParams) > 0 {
+		fmt.Fprintf(&b, "<< %s >> setpagedevice\n", strings.Join(deviceParams, " "))
+	}
+	for _, line := range body {
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "} stopped { (\\n%s ) print $error /errorname get =only (\\n) print } if flush\n", jobFailedMarker)
+	return b.String(), true
+}
+
+// run send a job to an idle worker, starting one if the pool is not full
+func (p *GhostscriptPool) run(ctx context.Context, job string, args []string) ([]byte, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	var w *gsWorker
+	select {
+	case w = <-p.idle:
+	default:
+		var err error
+		if w, err = p.startWorker(); err != nil {
+			return nil, err
+		}
+	}
+
+	output, failed, err := w.run(ctx, job)
+	w.jobs++
+	if err != nil || failed || w.jobs >= p.maxJobs || !p.put(w) {
+		// Errors can leave state behind in the interpreter, so the worker is replaced
+		w.stop()
+	}
+
+	if err != nil {
+		return output, err
+	}
+	if failed {
+		if isPasswordFailure(output) {
+			return output, passwordError(args)
+		}
+		return output, fmt.Errorf("ghostscript error: job failed, output: %s", string(output))
+	}
+	return output, nil
+}
+
+// put return a worker to the idle list, false once the pool is closed
+func (p *GhostscriptPool) put(w *gsWorker) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.idle <- w
+	return true
+}
+
+// startWorker start an interpreter reading jobs from stdin
+func (p *GhostscriptPool) startWorker() (*gsWorker, error) {
+	args := []string{"-q", "-dNOPAUSE", "-dSAFER", "-dNODISPLAY", "-dJOBSERVER"}
+	for _, dir := range p.readDirs {
+		args = append(args, fmt.Sprintf("--permit-file-read=%s%c", dir, os.PathSeparator))
+	}
+	for _, dir := range p.writeDirs {
+		args = append(args, fmt.Sprintf("--permit-file-write=%s%c", dir, os.PathSeparator))
+	}
+	args = append(args, "-")
+
+	cmd := p.newCommand(p.binaryPath, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Messages and job output share one stream so they stay in order
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		pr.Close()
+		pw.Close()
+		return nil, fmt.Errorf("failed to start ghostscript worker: %v", err)
+	}
+	pw.Close()
+
+	log.Printf("Started ghostscript worker %d", cmd.Process.Pid)
+	return &gsWorker{cmd: cmd, stdin: stdin, pipe: pr, output: bufio.NewReader(pr)}, nil
+}
+
+// run send one job followed by a job printing the done marker, which only runs once
+// the first job's device has been closed and its output files written
+func (w *gsWorker) run(ctx context.Context, job string) ([]byte, bool, error) {
+	if _, err := fmt.Fprintf(w.stdin, "%s\x04(\\n%s\\n) print flush\n\x04", job, jobDoneMarker); err != nil {
+		return nil, false, fmt.Errorf("ghostscript worker stopped: %v", err)
+	}
+
+	type result struct {
+		output []byte
+		failed bool
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		var output []byte
+		var failed bool
+		for {
+			line, err := w.output.ReadString('\n')
+			trimmed := strings.TrimSpace(line)
+			switch {
+			case trimmed == jobDoneMarker:
+				resultCh <- result{output: output, failed: failed}
+				return
+			case strings.HasPrefix(trimmed, jobFailedMarker):
+				failed = true
+				output = append(output, fmt.Sprintf("Error: %s\n", strings.TrimSpace(strings.TrimPrefix(trimmed, jobFailedMarker)))...)
+			default:
+				output = append(output, line...)
+			}
+			if err != nil {
+				resultCh <- result{output: output, err: fmt.Errorf("ghostscript worker stopped: %v, output: %s", err, string(output))}
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// The worker is mid job, killing it is the only way to stop it
+		w.cmd.Process.Kill()
+		return nil, false, ctx.Err()
+	case r := <-resultCh:
+		return r.output, r.failed, r.err
+	}
+}
+
+// stop end the interpreter, killing it if it does not exit on its own
+func (w *gsWorker) stop() {
+	w.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		w.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		w.cmd.Process.Kill()
+		<-done
+	}
+	w.pipe.Close()
+}
+
+// Close stop the idle workers, workers still running a job stop when it finishes
+func (p *GhostscriptPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	for {
+		select {
+		case w := <-p.idle:
+			w.stop()
+		default:
+			return
+		}
+	}
+}
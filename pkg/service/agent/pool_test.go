@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelperGhostscriptWorker stands in for a pooled interpreter when run by newHelperPool
+func TestHelperGhostscriptWorker(t *testing.T) {
+	if os.Getenv("FHA_HELPER_WORKER") != "1" {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		job, err := in.ReadString('\x04')
+		switch {
+		case strings.Contains(job, jobDoneMarker):
+			fmt.Printf("\n%s\n", jobDoneMarker)
+		case strings.Contains(job, "fail.pdf) run"):
+			fmt.Printf("\n%s undefinedfilename\n", jobFailedMarker)
+		case strings.TrimSpace(job) != "":
+			fmt.Printf("worker %d\n", os.Getpid())
+		}
+		if err != nil {
+			os.Exit(0)
+		}
+	}
+}
+
+func newHelperPool(t *testing.T, size, maxJobs int) *GhostscriptPool {
+	dir := t.TempDir()
+	pool := NewGhostscriptPool("gs", size, maxJobs, nil, []string{dir})
+	pool.newCommand = func(string, ...string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=TestHelperGhostscriptWorker")
+		cmd.Env = append(os.Environ(), "FHA_HELPER_WORKER=1")
+		return cmd
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestGhostscriptPoolJob(t *testing.T) {
+	dir := t.TempDir()
+	pool := NewGhostscriptPool("gs", 1, 1, nil, []string{dir})
+	input := filepath.Join(dir, "doc.pdf")
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name: "Render",
+			args: []string{"-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=png16m", "-r150", "-dTextAlphaBits=4",
+				"-sPageList=1,3", "-sOutputFile=" + filepath.Join(dir, "doc-%d.png"), input},
+			expected: []string{
+				"/PageList (1,3) def",
+				"(png16m) selectdevice",
+				fmt.Sprintf("<< /HWResolution [150 150] /TextAlphaBits 4 /OutputFile (%s) >> setpagedevice", filepath.Join(dir, "doc-%d.png")),
+				fmt.Sprintf("(%s) run", input),
+			},
+		},
+		{
+			name:     "Program",
+			args:     []string{"-q", "-dNODISPLAY", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-c", "(x) =", "-f"},
+			expected: []string{"nulldevice", "(x) ="},
+		},
+		{name: "Input outside the pool directories", args: []string{"-sDEVICE=png16m", "/etc/doc.pdf"}},
+		{name: "Output outside the pool directories", args: []string{"-sDEVICE=png16m", "-sOutputFile=/tmp/x.png", input}},
+		{name: "Unknown switch", args: []string{"-sDEVICE=png16m", "-dFIXEDMEDIA", input}},
+		{name: "Program ending the interpreter", args: []string{"-dNODISPLAY", "-c", "(x) = quit"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job, ok := pool.job(tc.args)
+			if ok != (tc.expected != nil) {
+				t.Fatalf("Expected pooled %v, got %v", tc.expected != nil, ok)
+			}
+			for _, line := range tc.expected {
+				if !strings.Contains(job, line+"\n") {
+					t.Errorf("Expected job to contain %q, got:\n%s", line, job)
+				}
+			}
+		})
+	}
+}
+
+func TestGhostscriptPoolRecyclesWorkers(t *testing.T) {
+	pool := newHelperPool(t, 1, 2)
+	input := filepath.Join(pool.writeDirs[0], "doc.pdf")
+	ctx := context.Background()
+
+	runJob := func(file string) (string, error) {
+		job, ok := pool.job([]string{"-sDEVICE=png16m", file})
+		if !ok {
+			t.Fatalf("Expected %s to run in the pool", file)
+		}
+		output, err := pool.run(ctx, job, nil)
+		return strings.TrimSpace(string(output)), err
+	}
+
+	var workers []string
+	for i := 0; i < 3; i++ {
+		worker, err := runJob(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		workers = append(workers, worker)
+	}
+	if workers[0] != workers[1] || workers[1] == workers[2] {
+		t.Errorf("Expected a new worker after 2 jobs, got %v", workers)
+	}
+
+	if _, err := runJob(filepath.Join(pool.writeDirs[0], "fail.pdf")); err == nil {
+		t.Error("Expected the failed job to return an error")
+	}
+	worker, err := runJob(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if worker == workers[2] {
+		t.Errorf("Expected a new worker after a failed job, still got %s", worker)
+	}
+}
+
+func BenchmarkRunGhostscript(b *testing.B) {
+	gsPath, err := exec.LookPath("gs")
+	if err != nil {
+		b.Skip("ghostscript not installed")
+	}
+	dir := b.TempDir()
+	input := filepath.Join(dir, "page.pdf")
+	if err := writeBlankPdf(input, 612, 792); err != nil {
+		b.Fatal(err)
+	}
+	args := []string{"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=png16m", "-r72",
+		"-sOutputFile=" + filepath.Join(dir, "page-%d.png"), input}
+
+	for _, bc := range []struct {
+		name string
+		pool *GhostscriptPool
+	}{
+		{name: "Exec"},
+		{name: "Pool", pool: NewGhostscriptPool(gsPath, 1, 1000, nil, []string{dir})},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			g := &GhostscriptAgent{BinaryPath: gsPath, Pool: bc.pool}
+			if bc.pool != nil {
+				defer bc.pool.Close()
+			}
+			for i := 0; i < b.N; i++ {
+				if _, err := g.runGhostscript(context.Background(), args); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
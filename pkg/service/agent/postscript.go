@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Input formats of the actions that only take PostScript
+var postScriptInputFormats = map[string]bool{
+	".ps":  true,
+	".eps": true,
+}
+
+// postScriptPageSizeProgram print the media size of every page as the document runs
+const postScriptPageSizeProgram = "<< /EndPage { exch pop dup 2 ne { (PAGESIZE\\t) print currentpagedevice /PageSize get == } if 2 ne } bind >> setpagedevice"
+
+// isPostScript report whether file is a PostScript or EPS document
+func isPostScript(file string) bool {
+	return postScriptInputFormats[strings.ToLower(filepath.Ext(file))]
+}
+
+// isEPS report whether file is an encapsulated PostScript document
+func isEPS(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".eps")
+}
+
+// postScriptInfo page count and page sizes of a PostScript document. PostScript has no
+// page index, so the document is run once through the bbox device to find them.
+func (g *GhostscriptAgent) postScriptInfo(ctx context.Context, file string) (PdfInfo, error) {
+	info := PdfInfo{
+		File: file,
+		Info: make(map[string]string),
+	}
+
+	args := []string{
+		"-q",
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		"-sDEVICE=bbox",
+		"-c", postScriptPageSizeProgram,
+		"-f",
+	}
+	args = append(args, inputFileArgs(nil, file)...)
+
+	output, err := g.runGhostscript(ctx, args)
+	if err != nil {
+		return info, err
+	}
+
+	if err := parsePostScriptPageSizes(output, &info); err != nil {
+		return info, fmt.Errorf("failed to inspect %s: %v", file, err)
+	}
+	return info, nil
+}
+
+// parsePostScriptPageSizes fill info from the lines printed by postScriptPageSizeProgram
+func parsePostScriptPageSizes(output []byte, info *PdfInfo) error {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		size, found := strings.CutPrefix(scanner.Text(), "PAGESIZE\t")
+		if !found {
+			continue
+		}
+		values := parsePSNumbers(size)
+		if len(values) != 2 {
+			return fmt.Errorf("invalid page size %q", size)
+		}
+		info.Pages = append(info.Pages, PageInfo{
+			Number:   len(info.Pages) + 1,
+			MediaBox: []float64{0, 0, values[0], values[1]},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(info.Pages) == 0 {
+		return fmt.Errorf("document has no pages")
+	}
+	info.PageCount = len(info.Pages)
+	return nil
+}
+
+// convertPsToPdf convert PostScript and EPS documents to pdf, EPS cropped to its bounding box
+func (g *GhostscriptAgent) convertPsToPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PostScript to PDF conversion for %d files", len(files))
+
+	if err := validateInputFormats(files, postScriptInputFormats); err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.rewriteEachPdf(ctx, params, files, func(string) ([]string, error) {
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PostScript to PDF conversion for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePostScriptPageSizes(t *testing.T) {
+	output := []byte("%%BoundingBox: 0 0 100 100\nPAGESIZE\t[612.0 792.0]\n%%HiResBoundingBox: 0 0 99.5 99.5\nPAGESIZE\t[842.0 595.0]\n")
+
+	var info PdfInfo
+	if err := parsePostScriptPageSizes(output, &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.PageCount != 2 {
+		t.Fatalf("Expected 2 pages, got %d", info.PageCount)
+	}
+	if width, height := info.Pages[1].pageSize(); width != 842 || height != 595 {
+		t.Errorf("Expected second page 842x595, got %vx%v", width, height)
+	}
+
+	if err := parsePostScriptPageSizes([]byte("GPL Ghostscript\n"), &PdfInfo{}); err == nil {
+		t.Error("Expected error for output without pages")
+	}
+}
+
+func TestInputFileArgsPostScript(t *testing.T) {
+	params := map[string]interface{}{"password": "secret"}
+
+	testCases := []struct {
+		file     string
+		expected []string
+	}{
+		{file: "doc.pdf", expected: []string{"-sPDFPassword=secret", "doc.pdf"}},
+		{file: "doc.ps", expected: []string{"doc.ps"}},
+		{file: "logo.EPS", expected: []string{"-dEPSCrop", "logo.EPS"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			if args := inputFileArgs(params, tc.file); !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("Expected args %v, got %v", tc.expected, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// pdfPermissions permission flags of an encrypted pdf
+type pdfPermissions struct {
+	print    bool
+	copy     bool
+	modify   bool
+	annotate bool
+}
+
+// Permission bits of the /P entry, zero based
+const (
+	permPrint         = 1 << 2
+	permModify        = 1 << 3
+	permCopy          = 1 << 4
+	permAnnotate      = 1 << 5
+	permFillForms     = 1 << 8
+	permAccessibility = 1 << 9
+	permAssemble      = 1 << 10
+	permPrintHigh     = 1 << 11
+	// Bits 7-8 and 13-32 are reserved and must be set
+	permReserved = 0xFFFFF0C0
+)
+
+// value signed /P value for -dPermissions, revision 3 maps each flag onto its extended bits as well
+func (p pdfPermissions) value(revision int) int32 {
+	bits := uint32(permReserved)
+	if revision < 3 {
+		// Revision 2 has no extended bits, they are reserved
+		bits |= permFillForms | permAccessibility | permAssemble | permPrintHigh
+	}
+	if p.print {
+		bits |= permPrint
+		if revision >= 3 {
+			bits |= permPrintHigh
+		}
+	}
+	if p.modify {
+		bits |= permModify
+		if revision >= 3 {
+			bits |= permAssemble
+		}
+	}
+	if p.copy {
+		bits |= permCopy
+		if revision >= 3 {
+			bits |= permAccessibility
+		}
+	}
+	if p.annotate {
+		bits |= permAnnotate
+		if revision >= 3 {
+			bits |= permFillForms
+		}
+	}
+	return int32(bits)
+}
+
+// protectPdf write encrypted copies of the input pdfs with owner/user passwords and permissions
+func (g *GhostscriptAgent) protectPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF protection for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	// pdfwrite only encrypts when an owner password is set
+	ownerPassword, _ := params["owner_password"].(string)
+	if ownerPassword == "" {
+		return nil, apperrors.NewInvalidParameterError("owner_password", "an owner password is required")
+	}
+	userPassword, _ := params["user_password"].(string)
+
+	keyLength, ok, err := wholeNumberParam(params, "key_length")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		keyLength = 128
+	}
+
+	// pdfwrite writes RC4 encryption, revision 2 for 40-bit keys and revision 3 above
+	var revision int
+	switch keyLength {
+	case 40:
+		revision = 2
+	case 128:
+		revision = 3
+	default:
+		return nil, apperrors.NewInvalidParameterError("key_length", "must be 40 or 128")
+	}
+
+	permissions := pdfPermissions{}
+	permissions.print, _ = params["allow_print"].(bool)
+	permissions.copy, _ = params["allow_copy"].(bool)
+	permissions.modify, _ = params["allow_modify"].(bool)
+	permissions.annotate, _ = params["allow_annotate"].(bool)
+
+	args := []string{
+		fmt.Sprintf("-sOwnerPassword=%s", ownerPassword),
+		fmt.Sprintf("-dKeyLength=%d", keyLength),
+		fmt.Sprintf("-dEncryptionR=%d", revision),
+		fmt.Sprintf("-dPermissions=%d", permissions.value(revision)),
+	}
+	if userPassword != "" {
+		args = append(args, fmt.Sprintf("-sUserPassword=%s", userPassword))
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, colorArgs...)
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		fileArgs := append(pdfwriteArgs(outputFile), args...)
+		fileArgs = append(fileArgs, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, fileArgs); err != nil {
+			return nil, err
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF protection for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
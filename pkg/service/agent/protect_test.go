@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestPdfPermissionsValue(t *testing.T) {
+	testCases := []struct {
+		name        string
+		permissions pdfPermissions
+		revision    int
+		expected    int32
+	}{
+		{name: "Nothing allowed, revision 3", permissions: pdfPermissions{}, revision: 3, expected: -3904},
+		{name: "Print only, revision 3", permissions: pdfPermissions{print: true}, revision: 3, expected: -1852},
+		{name: "Everything allowed, revision 3", permissions: pdfPermissions{print: true, copy: true, modify: true, annotate: true}, revision: 3, expected: -4},
+		{name: "Nothing allowed, revision 2", permissions: pdfPermissions{}, revision: 2, expected: -64},
+		{name: "Copy only, revision 2", permissions: pdfPermissions{copy: true}, revision: 2, expected: -48},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if value := tc.permissions.value(tc.revision); value != tc.expected {
+				t.Errorf("Expected permissions %d, got %d", tc.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Supported fit modes for target pixel dimensions
+const (
+	fitContain = "contain"
+	fitCover   = "cover"
+	fitExact   = "exact"
+)
+
+// maxTargetDimension largest accepted target width or height in pixels
+const maxTargetDimension = 20000
+
+// fitOptions target pixel dimensions requested instead of a resolution
+type fitOptions struct {
+	width  int // 0 when only the height is constrained
+	height int // 0 when only the width is constrained
+	mode   string
+}
+
+// renderPass pages rendered by a single ghostscript run at one resolution
+type renderPass struct {
+	pages []int
+	xres  float64
+	yres  float64
+	// Fit cover only: the fixed output size in pixels, and the shift in points
+	// centering the pages in it so the overflow is cropped evenly from both sides
+	width, height    int
+	offsetX, offsetY float64
+}
+
+// parseFitOptions read width, height and fit, returning nil when no pixel size was requested
+func parseFitOptions(params map[string]interface{}) (*fitOptions, error) {
+	width, hasWidth, err := wholeNumberParam(params, "width")
+	if err != nil {
+		return nil, err
+	}
+	height, hasHeight, err := wholeNumberParam(params, "height")
+	if err != nil {
+		return nil, err
+	}
+	if !hasWidth && !hasHeight {
+		return nil, nil
+	}
+
+	if hasWidth && (width < 1 || width > maxTargetDimension) {
+		return nil, apperrors.NewInvalidParameterError("width", fmt.Sprintf("must be between 1 and %d", maxTargetDimension))
+	}
+	if hasHeight && (height < 1 || height > maxTargetDimension) {
+		return nil, apperrors.NewInvalidParameterError("height", fmt.Sprintf("must be between 1 and %d", maxTargetDimension))
+	}
+	if _, ok := params["resolution"]; ok {
+		return nil, apperrors.NewInvalidParameterError("resolution", "cannot be combined with width or height")
+	}
+
+	mode, _ := params["fit"].(string)
+	if mode == "" {
+		mode = fitContain
+	}
+	switch mode {
+	case fitContain:
+	case fitCover, fitExact:
+		if !hasWidth || !hasHeight {
+			return nil, apperrors.NewInvalidParameterError("fit", fmt.Sprintf("%s needs both width and height", mode))
+		}
+	default:
+		return nil, apperrors.NewInvalidParameterError("fit", fmt.Sprintf("unsupported fit mode %q", mode))
+	}
+
+	return &fitOptions{width: width, height: height, mode: mode}, nil
+}
+
+// resolution horizontal and vertical resolution rendering a page of pageWidth x pageHeight points at the target size
+func (f fitOptions) resolution(pageWidth, pageHeight float64) (float64, float64) {
+	scaleX := float64(f.width) / pageWidth
+	scaleY := float64(f.height) / pageHeight
+
+	var scale float64
+	switch {
+	case f.mode == fitExact:
+		return scaleX * 72, scaleY * 72
+	case f.width == 0:
+		scale = scaleY
+	case f.height == 0:
+		scale = scaleX
+	case f.mode == fitCover:
+		scale = max(scaleX, scaleY)
+	default:
+		scale = min(scaleX, scaleY)
+	}
+	return scale * 72, scale * 72
+}
+
+// planRenderPasses group the selected pages by the resolution and crop that render them at the target size
+func (f fitOptions) planRenderPasses(pages []int, info PdfInfo) ([]renderPass, error) {
+	byPage := make(map[int]PageInfo, len(info.Pages))
+	for _, page := range info.Pages {
+		byPage[page.Number] = page
+	}
+
+	var passes []renderPass
+	passIndex := make(map[[4]float64]int)
+	for _, number := range pages {
+		page, ok := byPage[number]
+		if !ok {
+			return nil, fmt.Errorf("no size information for page %d", number)
+		}
+		pageWidth, pageHeight := page.pageSize()
+		if pageWidth <= 0 || pageHeight <= 0 {
+			return nil, fmt.Errorf("page %d has an empty media box", number)
+		}
+
+		pass := renderPass{}
+		pass.xres, pass.yres = f.resolution(pageWidth, pageHeight)
+		if f.mode == fitCover {
+			pass.width, pass.height = f.width, f.height
+			// Rounded so float noise neither splits passes nor reaches the PostScript
+			pass.offsetX = math.Round((pageWidth-float64(f.width)*72/pass.xres)/2*1000) / 1000
+			pass.offsetY = math.Round((pageHeight-float64(f.height)*72/pass.yres)/2*1000) / 1000
+		}
+
+		key := [4]float64{pass.xres, pass.yres, pass.offsetX, pass.offsetY}
+		idx, ok := passIndex[key]
+		if !ok {
+			idx = len(passes)
+			passIndex[key] = idx
+			passes = append(passes, pass)
+		}
+		passes[idx].pages = append(passes[idx].pages, number)
+	}
+
+	sort.Slice(passes, func(i, j int) bool { return passes[i].pages[0] < passes[j].pages[0] })
+	return passes, nil
+}
+
+// frameArgs ghostscript switches fixing the output size of a fit cover pass,
+// none for other passes whose output size follows from the resolution
+func (p renderPass) frameArgs(downScaleFactor int) []string {
+	if p.width == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("-g%dx%d", p.width*downScaleFactor, p.height*downScaleFactor), "-dFIXEDMEDIA"}
+}
+
+// shiftArgs ghostscript program centering the pages of a fit cover pass in its fixed frame,
+// which must follow every switch since the device is set up when it runs
+func (p renderPass) shiftArgs() []string {
+	if p.width == 0 {
+		return nil
+	}
+	return []string{
+		"-c", fmt.Sprintf("<< /BeginPage { pop %s %s translate } bind >> setpagedevice",
+			formatPSNumber(-p.offsetX), formatPSNumber(-p.offsetY)),
+		"-f",
+	}
+}
+
+// renderPassArgs ghostscript arguments rendering one pass of convertPdfToImage,
+// switches holds the output, color and font switches and programs the watermark and input arguments
+func renderPassArgs(device string, encoding encodingOptions, fit *fitOptions, multiPage bool, pass renderPass, pageCount int, switches, programs []string) []string {
+	args := []string{
+		"-dNOPAUSE",
+		"-dBATCH",
+		"-dSAFER",
+		fmt.Sprintf("-sDEVICE=%s", device),
+	}
+	if fit != nil && multiPage {
+		// A multi page file has a single frame size, so fit every page into it
+		args = append(args, encoding.args(72, 72)...)
+		args = append(args,
+			fmt.Sprintf("-g%dx%d", fit.width*encoding.downScaleFactor, fit.height*encoding.downScaleFactor),
+			"-dFIXEDMEDIA",
+			"-dPDFFitPage",
+		)
+	} else {
+		args = append(args, encoding.args(pass.xres, pass.yres)...)
+		args = append(args, pass.frameArgs(encoding.downScaleFactor)...)
+	}
+
+	// Set page range
+	args = append(args, pageSelectionArgs(pass.pages, pageCount)...)
+	args = append(args, switches...)
+
+	// Ghostscript sets up the device at the first program, so these come last
+	args = append(args, pass.shiftArgs()...)
+	return append(args, programs...)
+}
+
+// pageSize width and height in points of the media box as rendered, honoring rotation
+func (p PageInfo) pageSize() (float64, float64) {
+	if p.MediaBox == nil {
+		return 0, 0
+	}
+	width, height := p.MediaBox[2]-p.MediaBox[0], p.MediaBox[3]-p.MediaBox[1]
+	if width < 0 {
+		width = -width
+	}
+	if height < 0 {
+		height = -height
+	}
+	if p.Rotate == 90 || p.Rotate == 270 {
+		return height, width
+	}
+	return width, height
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanRenderPasses(t *testing.T) {
+	info := PdfInfo{
+		PageCount: 3,
+		Pages: []PageInfo{
+			{Number: 1, MediaBox: []float64{0, 0, 612, 792}},
+			{Number: 2, MediaBox: []float64{0, 0, 612, 792}, Rotate: 90},
+			{Number: 3, MediaBox: []float64{0, 0, 612, 792}},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		fit            fitOptions
+		expectedPasses int
+		// expected pixel size of page 1
+		expectedWidth  float64
+		expectedHeight float64
+	}{
+		{name: "Contain", fit: fitOptions{width: 300, height: 400, mode: fitContain}, expectedPasses: 2, expectedWidth: 300, expectedHeight: 388.235},
+		{name: "Cover", fit: fitOptions{width: 300, height: 400, mode: fitCover}, expectedPasses: 2, expectedWidth: 300, expectedHeight: 400},
+		{name: "Exact", fit: fitOptions{width: 200, height: 100, mode: fitExact}, expectedPasses: 2, expectedWidth: 200, expectedHeight: 100},
+		{name: "Width only", fit: fitOptions{width: 306, mode: fitContain}, expectedPasses: 2, expectedWidth: 306, expectedHeight: 396},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			passes, err := tc.fit.planRenderPasses([]int{1, 2, 3}, info)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(passes) != tc.expectedPasses {
+				t.Fatalf("Expected %d passes, got %d", tc.expectedPasses, len(passes))
+			}
+			if len(passes[0].pages) != 2 || passes[0].pages[0] != 1 || passes[0].pages[1] != 3 {
+				t.Errorf("Expected pages 1 and 3 to share a pass, got %v", passes[0].pages)
+			}
+
+			width := 612 * passes[0].xres / 72
+			height := 792 * passes[0].yres / 72
+			if passes[0].width > 0 {
+				width, height = float64(passes[0].width), float64(passes[0].height)
+			}
+			if abs(width-tc.expectedWidth) > 0.01 || abs(height-tc.expectedHeight) > 0.01 {
+				t.Errorf("Expected %vx%v pixels, got %vx%v", tc.expectedWidth, tc.expectedHeight, width, height)
+			}
+		})
+	}
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestPlanRenderPassesCoverCrop(t *testing.T) {
+	fit := fitOptions{width: 300, height: 400, mode: fitCover}
+	info := PdfInfo{
+		PageCount: 2,
+		Pages: []PageInfo{
+			{Number: 1, MediaBox: []float64{0, 0, 612, 792}},
+			// Rendered at the same resolution as page 1, but needs no crop
+			{Number: 2, MediaBox: []float64{0, 0, 594, 792}},
+		},
+	}
+
+	passes, err := fit.planRenderPasses([]int{1, 2}, info)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(passes) != 2 {
+		t.Fatalf("Expected pages with different crops in separate passes, got %+v", passes)
+	}
+
+	// Page 1 renders 309.091 pixels wide, the 18 points left over are cropped evenly
+	if passes[0].offsetX != 9 || passes[0].offsetY != 0 {
+		t.Errorf("Expected page 1 shifted by 9x0 points, got %vx%v", passes[0].offsetX, passes[0].offsetY)
+	}
+	if passes[1].offsetX != 0 || passes[1].offsetY != 0 {
+		t.Errorf("Expected page 2 unshifted, got %vx%v", passes[1].offsetX, passes[1].offsetY)
+	}
+
+	if args, expected := passes[0].frameArgs(2), []string{"-g600x800", "-dFIXEDMEDIA"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+	if args, expected := passes[0].shiftArgs(), []string{"-c", "<< /BeginPage { pop -9 0 translate } bind >> setpagedevice", "-f"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestRenderPassArgsOrder(t *testing.T) {
+	fit := &fitOptions{width: 300, height: 400, mode: fitCover}
+	pass := renderPass{pages: []int{1}, xres: 72, yres: 72, width: 300, height: 400, offsetX: 9}
+	encoding := encodingOptions{pngCompression: -1, downScaleFactor: 1}
+	switches := []string{"-sOutputFile=out-%d.png", "-sOutputICCProfile=/profiles/sRGB.icc", "-sFONTPATH=/fonts"}
+	programs := []string{"prelude.ps", "-c", "<< /EndPage { stamp } >> setpagedevice", "-f", "in.pdf"}
+
+	args := renderPassArgs("png16m", encoding, fit, false, pass, 1, switches, programs)
+
+	index := func(arg string) int {
+		for i, a := range args {
+			if a == arg {
+				return i
+			}
+		}
+		t.Fatalf("Expected %q in %v", arg, args)
+		return -1
+	}
+	frame, shift := index("-dFIXEDMEDIA"), index("<< /BeginPage { pop -9 0 translate } bind >> setpagedevice")
+	for _, s := range switches {
+		if i := index(s); i < frame || i > shift {
+			t.Errorf("Expected %q between the frame switches and the shift program, got %v", s, args)
+		}
+	}
+	if first := index("-c"); first != shift-1 {
+		t.Errorf("Expected the shift program to be the first program, got %v", args)
+	}
+	if !reflect.DeepEqual(args[len(args)-len(programs):], programs) || args[shift+1] != "-f" || shift+2 != len(args)-len(programs) {
+		t.Errorf("Expected the shift program right before %v, got %v", programs, args)
+	}
+}
@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// Supported split modes
+const (
+	splitModePage   = "page"
+	splitModeEvery  = "every"
+	splitModeRanges = "ranges"
+)
+
+// splitPdf break each input pdf into separate pdfs, one per page or one per page group
+func (g *GhostscriptAgent) splitPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF split for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	opts, err := parseSplitOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+
+		// A single pass writes one file per page
+		if opts.mode == splitModePage {
+			selectedPages, err := opts.selection.resolve(pageCount)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			outputPattern := filepath.Join(fileOutputDir, fmt.Sprintf("%s-%%d.pdf", baseNameWithoutExt))
+			args := append(pdfwriteArgs(outputPattern), colorArgs...)
+			args = append(args, pageSelectionArgs(selectedPages, pageCount)...)
+			args = append(args, inputFileArgs(params, file)...)
+
+			if _, err := g.runGhostscript(ctx, args); err != nil {
+				return nil, err
+			}
+			return renumberOutputFiles(outputPattern, selectedPages)
+		}
+
+		// Otherwise one pass per page group
+		pageGroups, err := opts.pageGroups(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		var outputs []string
+		for i, groupPages := range pageGroups {
+			outputFile := filepath.Join(fileOutputDir, fmt.Sprintf("%s-part%d.pdf", baseNameWithoutExt, i+1))
+			args := append(pdfwriteArgs(outputFile), colorArgs...)
+			args = append(args, fmt.Sprintf("-sPageList=%s", formatPageList(groupPages)))
+			args = append(args, inputFileArgs(params, file)...)
+
+			if _, err := g.runGhostscript(ctx, args); err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, outputFile)
+		}
+		return outputs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF split for %d files into %d files in %v", len(files), len(outputFiles), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// splitOptions how splitPdf divides each input
+type splitOptions struct {
+	mode      string
+	selection pageSelection   // pages taking part in page and every-N splits
+	everyN    int             // pages per group of an every-N split
+	groups    []pageSelection // groups of a ranges split
+}
+
+// parseSplitOptions read split_mode and the parameters of that mode
+func parseSplitOptions(params map[string]interface{}) (*splitOptions, error) {
+	opts := &splitOptions{}
+	opts.mode, _ = params["split_mode"].(string)
+	if opts.mode == "" {
+		opts.mode = splitModePage
+	}
+
+	pages, _ := params["pages"].(string)
+	if pages == "" {
+		pages = "all"
+	}
+
+	var err error
+	if opts.selection, err = parsePageSelection(pages); err != nil {
+		return nil, err
+	}
+
+	switch opts.mode {
+	case splitModePage:
+	case splitModeEvery:
+		n, _, err := wholeNumberParam(params, "every_n")
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, apperrors.NewInvalidParameterError("every_n", "must be a positive whole number")
+		}
+		opts.everyN = n
+	case splitModeRanges:
+		rawRanges, _ := params["ranges"].([]interface{})
+		if len(rawRanges) == 0 {
+			return nil, apperrors.NewInvalidParameterError("ranges", "at least one page range is required")
+		}
+		for i, raw := range rawRanges {
+			expr, ok := raw.(string)
+			if !ok {
+				return nil, apperrors.NewInvalidParameterError("ranges", fmt.Sprintf("entry %d is not a string", i))
+			}
+			group, err := parsePageSelection(expr)
+			if err != nil {
+				return nil, err
+			}
+			opts.groups = append(opts.groups, group)
+		}
+	default:
+		return nil, apperrors.NewInvalidParameterError("split_mode", fmt.Sprintf("unsupported mode %q", opts.mode))
+	}
+
+	return opts, nil
+}
+
+// pageGroups pages of each output file of an every-N or ranges split, the last
+// every-N group holding whatever pages are left
+func (o splitOptions) pageGroups(pageCount int) ([][]int, error) {
+	var pageGroups [][]int
+	if o.mode == splitModeEvery {
+		selectedPages, err := o.selection.resolve(pageCount)
+		if err != nil {
+			return nil, err
+		}
+		for start := 0; start < len(selectedPages); start += o.everyN {
+			pageGroups = append(pageGroups, selectedPages[start:min(start+o.everyN, len(selectedPages))])
+		}
+		return pageGroups, nil
+	}
+
+	for _, group := range o.groups {
+		groupPages, err := group.resolve(pageCount)
+		if err != nil {
+			return nil, err
+		}
+		pageGroups = append(pageGroups, groupPages)
+	}
+	return pageGroups, nil
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPageGroups(t *testing.T) {
+	testCases := []struct {
+		name        string
+		params      map[string]interface{}
+		pageCount   int
+		expected    [][]int
+		expectError bool
+	}{
+		{
+			name:      "Every N",
+			params:    map[string]interface{}{"split_mode": "every", "every_n": 2.0},
+			pageCount: 6,
+			expected:  [][]int{{1, 2}, {3, 4}, {5, 6}},
+		},
+		{
+			name:      "Every N with a final partial group",
+			params:    map[string]interface{}{"split_mode": "every", "every_n": 3.0},
+			pageCount: 7,
+			expected:  [][]int{{1, 2, 3}, {4, 5, 6}, {7}},
+		},
+		{
+			name:      "Every N of selected pages",
+			params:    map[string]interface{}{"split_mode": "every", "every_n": 2.0, "pages": "odd"},
+			pageCount: 7,
+			expected:  [][]int{{1, 3}, {5, 7}},
+		},
+		{
+			name:      "Every N larger than the document",
+			params:    map[string]interface{}{"split_mode": "every", "every_n": 10.0},
+			pageCount: 3,
+			expected:  [][]int{{1, 2, 3}},
+		},
+		{
+			name:      "Explicit ranges",
+			params:    map[string]interface{}{"split_mode": "ranges", "ranges": []interface{}{"1-2", "3,5", "4-last"}},
+			pageCount: 6,
+			expected:  [][]int{{1, 2}, {3, 5}, {4, 5, 6}},
+		},
+		{
+			name:        "Range past the last page",
+			params:      map[string]interface{}{"split_mode": "ranges", "ranges": []interface{}{"1-2", "8"}},
+			pageCount:   6,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseSplitOptions(tc.params)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			groups, err := opts.pageGroups(tc.pageCount)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(groups, tc.expected) {
+				t.Errorf("Expected groups %v, got %v", tc.expected, groups)
+			}
+		})
+	}
+}
+
+func TestParseSplitOptions(t *testing.T) {
+	testCases := []struct {
+		name   string
+		params map[string]interface{}
+	}{
+		{name: "Unknown mode", params: map[string]interface{}{"split_mode": "halves"}},
+		{name: "Every N missing", params: map[string]interface{}{"split_mode": "every"}},
+		{name: "Every N zero", params: map[string]interface{}{"split_mode": "every", "every_n": 0.0}},
+		{name: "Every N fractional", params: map[string]interface{}{"split_mode": "every", "every_n": 1.5}},
+		{name: "No ranges", params: map[string]interface{}{"split_mode": "ranges"}},
+		{name: "Range not a string", params: map[string]interface{}{"split_mode": "ranges", "ranges": []interface{}{1}}},
+		{name: "Bad range", params: map[string]interface{}{"split_mode": "ranges", "ranges": []interface{}{"3-1"}}},
+		{name: "Bad pages", params: map[string]interface{}{"pages": "x"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseSplitOptions(tc.params); !apperrors.IsInvalidParameter(err) {
+				t.Errorf("Expected invalid parameter error, got %v", err)
+			}
+		})
+	}
+}
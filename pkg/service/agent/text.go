@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inlineTextLimit largest amount of extracted text returned inline in the response
+const inlineTextLimit = 64 * 1024
+
+// extractText extract text from the input pdfs with the txtwrite device,
+// as one text file per page or one combined file per input.
+// Like convertPdfToImage it reads only the first page unless pages says otherwise.
+func (g *GhostscriptAgent) extractText(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting text extraction for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	selection, textMode, err := parseTextOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Text extraction also depends on fonts for character codes
+	fonts, err := g.parseFontOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	fontArgs, removeFontmap, err := fonts.prepare(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	defer removeFontmap()
+	fontReports := make([][]FontSubstitution, len(files))
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, fileIdx int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+
+		selectedPages, err := selection.resolve(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".txt")
+		if textMode == "page" {
+			outputFile = filepath.Join(fileOutputDir, fmt.Sprintf("%s-%%d.txt", baseNameWithoutExt))
+		}
+
+		args := []string{
+			"-dNOPAUSE",
+			"-dBATCH",
+			"-dSAFER",
+			"-sDEVICE=txtwrite",
+			fmt.Sprintf("-sOutputFile=%s", outputFile),
+		}
+		args = append(args, pageSelectionArgs(selectedPages, pageCount)...)
+		args = append(args, fontArgs...)
+		args = append(args, inputFileArgs(params, file)...)
+
+		output, err := g.runGhostscript(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if fontReports[fileIdx], err = fonts.check(file, output); err != nil {
+			os.RemoveAll(fileOutputDir)
+			return nil, err
+		}
+
+		if textMode == "page" {
+			return renumberOutputFiles(outputFile, selectedPages)
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if substitutions := fontMetadata(fontReports); len(substitutions) > 0 {
+		setMetadata(params, substitutions)
+	}
+
+	// Small documents also get their text inline
+	if text, ok := readInlineText(outputFiles, inlineTextLimit); ok {
+		params["processorOutput"] = text
+	}
+
+	log.Printf("Completed text extraction for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
+
+// parseTextOptions read the page selection and text_mode of extractText
+func parseTextOptions(params map[string]interface{}) (pageSelection, string, error) {
+	// Same page expressions and default as convertPdfToImage
+	pages, _ := params["pages"].(string)
+	if pages == "" {
+		pages = defaultContentPages
+	}
+
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, "", err
+	}
+
+	textMode, _ := params["text_mode"].(string)
+	if textMode == "" {
+		textMode = "page"
+	}
+	if textMode != "page" && textMode != "combined" {
+		return nil, "", apperrors.NewInvalidParameterError("text_mode", fmt.Sprintf("unsupported mode %q", textMode))
+	}
+	return selection, textMode, nil
+}
+
+// readInlineText concatenate the text files, separated by form feeds, if together they fit in limit bytes
+func readInlineText(files []string, limit int64) (string, bool) {
+	var total int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", false
+		}
+		total += info.Size()
+	}
+	if total > limit {
+		return "", false
+	}
+
+	texts := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false
+		}
+		texts = append(texts, string(data))
+	}
+	return strings.Join(texts, "\f"), true
+}
@@ -0,0 +1,82 @@
+package agent
+
+import (
+	apperrors "file-handler-agent/pkg/error"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTextOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        map[string]interface{}
+		expectedPages []int // resolved against a 3 page document
+		expectedMode  string
+		expectError   bool
+	}{
+		{name: "Defaults", params: map[string]interface{}{}, expectedPages: []int{1}, expectedMode: "page"},
+		{name: "All pages combined", params: map[string]interface{}{"pages": "all", "text_mode": "combined"}, expectedPages: []int{1, 2, 3}, expectedMode: "combined"},
+		{name: "Page range", params: map[string]interface{}{"pages": "2-last"}, expectedPages: []int{2, 3}, expectedMode: "page"},
+		{name: "Bad pages", params: map[string]interface{}{"pages": "x"}, expectError: true},
+		{name: "Unknown mode", params: map[string]interface{}{"text_mode": "html"}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selection, mode, err := parseTextOptions(tc.params)
+			if tc.expectError {
+				if !apperrors.IsInvalidParameter(err) {
+					t.Errorf("Expected invalid parameter error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pages, err := selection.resolve(3)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(pages, tc.expectedPages) || mode != tc.expectedMode {
+				t.Errorf("Expected pages %v in %s mode, got %v in %s mode", tc.expectedPages, tc.expectedMode, pages, mode)
+			}
+		})
+	}
+}
+
+func TestReadInlineText(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "doc-1.txt")
+	second := filepath.Join(dir, "doc-2.txt")
+	if err := os.WriteFile(first, []byte("first page"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		files    []string
+		limit    int64
+		expected string
+		ok       bool
+	}{
+		{name: "Single file", files: []string{first}, limit: 64, expected: "first page", ok: true},
+		{name: "Pages separated by form feeds", files: []string{first, second}, limit: 64, expected: "first page\fsecond", ok: true},
+		{name: "Over the limit", files: []string{first, second}, limit: 10},
+		{name: "Missing file", files: []string{first, filepath.Join(dir, "missing.txt")}, limit: 64},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, ok := readInlineText(tc.files, tc.limit)
+			if ok != tc.ok || text != tc.expected {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tc.expected, tc.ok, text, ok)
+			}
+		})
+	}
+}
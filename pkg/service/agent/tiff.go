@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFF tags read while walking the pages, the pixels are left to the decoder
+const (
+	tiffXResolution    = 282
+	tiffYResolution    = 283
+	tiffResolutionUnit = 296
+)
+
+// maxTIFFPages pages read from one file, which also stops looping page chains
+const maxTIFFPages = 10000
+
+// tiffPage where one page starts and the resolution it records
+type tiffPage struct {
+	offset     uint32
+	dpiX, dpiY float64
+}
+
+// decodeTIFF decode every page of a TIFF file
+func decodeTIFF(data []byte) ([]*pdfImage, error) {
+	pages, err := tiffPages(data)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*pdfImage, 0, len(pages))
+	for i, page := range pages {
+		// The decoder only reads the first page, so point the header at each page in turn
+		r := io.NewSectionReader(tiffPageReader{data: data, offset: page.offset}, 0, int64(len(data)))
+		cfg, err := tiff.DecodeConfig(r)
+		if err != nil {
+			return nil, tiffError(i, err)
+		}
+		if err := checkImageSize(cfg); err != nil {
+			return nil, fmt.Errorf("cannot decode TIFF page %d: %v", i+1, err)
+		}
+
+		src, err := tiff.Decode(io.NewSectionReader(tiffPageReader{data: data, offset: page.offset}, 0, int64(len(data))))
+		if err != nil {
+			return nil, tiffError(i, err)
+		}
+		img, err := rasterImage(src)
+		if err != nil {
+			return nil, err
+		}
+		img.dpiX, img.dpiY = page.dpiX, page.dpiY
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// tiffError report a decoder error, features the decoder lacks as an unsupported format
+func tiffError(page int, err error) error {
+	var unsupported tiff.UnsupportedError
+	if errors.As(err, &unsupported) {
+		return apperrors.NewUnsupportedFormatError(fmt.Sprintf("TIFF with %s", string(unsupported)))
+	}
+	return fmt.Errorf("cannot decode TIFF page %d: %v", page+1, err)
+}
+
+// tiffPageReader TIFF data whose header points at the page at offset
+type tiffPageReader struct {
+	data   []byte
+	offset uint32
+}
+
+// ReadAt read the data with the first page offset replaced
+func (r tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off < 8 {
+		var header [8]byte
+		copy(header[:], r.data[:8])
+		tiffByteOrder(r.data).PutUint32(header[4:], r.offset)
+		copy(p, header[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// tiffByteOrder byte order named by a TIFF header, which must already have been checked
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	if data[0] == 'M' {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// tiffPages follow the chain of image directories, one per page
+func tiffPages(data []byte) ([]tiffPage, error) {
+	if len(data) < 8 || !(bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))) {
+		return nil, fmt.Errorf("cannot decode TIFF: missing header")
+	}
+	order := tiffByteOrder(data)
+
+	var pages []tiffPage
+	seen := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:]); offset != 0; {
+		if seen[offset] || len(pages) == maxTIFFPages {
+			return nil, fmt.Errorf("cannot decode TIFF: invalid page chain")
+		}
+		seen[offset] = true
+
+		start := int(offset)
+		if start < 8 || start+2 > len(data) {
+			return nil, fmt.Errorf("cannot decode TIFF: page %d out of range", len(pages)+1)
+		}
+		count := int(order.Uint16(data[start:]))
+		end := start + 2 + count*12
+		if end+4 > len(data) {
+			return nil, fmt.Errorf("cannot decode TIFF: page %d out of range", len(pages)+1)
+		}
+
+		page := tiffPage{offset: offset}
+		unit := uint16(2)
+		for entry := start + 2; entry < end; entry += 12 {
+			switch order.Uint16(data[entry:]) {
+			case tiffXResolution:
+				page.dpiX = tiffRational(data, order, entry)
+			case tiffYResolution:
+				page.dpiY = tiffRational(data, order, entry)
+			case tiffResolutionUnit:
+				unit = order.Uint16(data[entry+8:])
+			}
+		}
+		switch unit {
+		case 2: // inch
+		case 3: // centimeter
+			page.dpiX, page.dpiY = page.dpiX*2.54, page.dpiY*2.54
+		default:
+			page.dpiX, page.dpiY = 0, 0
+		}
+
+		pages = append(pages, page)
+		offset = order.Uint32(data[end:])
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("cannot decode TIFF: no pages")
+	}
+	return pages, nil
+}
+
+// tiffRational value of a single RATIONAL entry, 0 when malformed
+func tiffRational(data []byte, order binary.ByteOrder, entry int) float64 {
+	const rationalType = 5
+	if order.Uint16(data[entry+2:]) != rationalType || order.Uint32(data[entry+4:]) != 1 {
+		return 0
+	}
+	offset := int(order.Uint32(data[entry+8:]))
+	if offset < 0 || offset+8 > len(data) {
+		return 0
+	}
+	numerator, denominator := order.Uint32(data[offset:]), order.Uint32(data[offset+4:])
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	apperrors "file-handler-agent/pkg/error"
+	"testing"
+)
+
+// testTIFFPage one 8 bit gray page for buildTIFF
+type testTIFFPage struct {
+	width, height uint32
+	compression   uint16
+	strip         []byte
+	dpi           uint32 // written with unit when set
+	unit          uint16
+}
+
+// buildTIFF little endian TIFF with one image directory per page
+func buildTIFF(pages ...testTIFFPage) []byte {
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	binary.Write(&b, binary.LittleEndian, uint32(8))
+	for i, page := range pages {
+		entries := []entry{
+			{256, 4, page.width},
+			{257, 4, page.height},
+			{258, 3, 8},
+			{259, 3, uint32(page.compression)},
+			{262, 3, 1},
+			{273, 4, 0},
+			{279, 4, uint32(len(page.strip))},
+		}
+		if page.dpi != 0 {
+			entries = append(entries, entry{tiffXResolution, 5, 0}, entry{tiffYResolution, 5, 0}, entry{tiffResolutionUnit, 3, uint32(page.unit)})
+		}
+
+		// The directory is followed by the two resolutions and then the strip
+		start := uint32(b.Len())
+		rationals := start + 2 + uint32(len(entries))*12 + 4
+		strip := rationals + 16
+		next := strip + uint32(len(page.strip))
+		if i == len(pages)-1 {
+			next = 0
+		}
+
+		binary.Write(&b, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			switch e.tag {
+			case 273:
+				e.value = strip
+			case tiffXResolution:
+				e.value = rationals
+			case tiffYResolution:
+				e.value = rationals + 8
+			}
+			binary.Write(&b, binary.LittleEndian, e.tag)
+			binary.Write(&b, binary.LittleEndian, e.typ)
+			binary.Write(&b, binary.LittleEndian, uint32(1))
+			if e.typ == 3 {
+				binary.Write(&b, binary.LittleEndian, uint16(e.value))
+				binary.Write(&b, binary.LittleEndian, uint16(0))
+			} else {
+				binary.Write(&b, binary.LittleEndian, e.value)
+			}
+		}
+		binary.Write(&b, binary.LittleEndian, next)
+		binary.Write(&b, binary.LittleEndian, []uint32{page.dpi, 1, page.dpi, 1})
+		b.Write(page.strip)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeTIFF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pages    []testTIFFPage
+		expected []pdfImage
+	}{
+		{
+			name:     "Uncompressed",
+			pages:    []testTIFFPage{{width: 3, height: 2, compression: 1, strip: []byte{1, 2, 3, 4, 5, 6}}},
+			expected: []pdfImage{{width: 3, height: 2}},
+		},
+		{
+			name:     "PackBits",
+			pages:    []testTIFFPage{{width: 3, height: 2, compression: 32773, strip: []byte{0x02, 1, 2, 3, 0xfe, 7}}},
+			expected: []pdfImage{{width: 3, height: 2}},
+		},
+		{
+			name: "Several pages",
+			pages: []testTIFFPage{
+				{width: 2, height: 1, compression: 1, strip: []byte{1, 2}, dpi: 300, unit: 2},
+				{width: 1, height: 3, compression: 1, strip: []byte{1, 2, 3}, dpi: 100, unit: 3},
+				{width: 1, height: 1, compression: 1, strip: []byte{1}, dpi: 72, unit: 1},
+			},
+			expected: []pdfImage{
+				{width: 2, height: 1, dpiX: 300, dpiY: 300},
+				{width: 1, height: 3, dpiX: 254, dpiY: 254},
+				{width: 1, height: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			images, err := decodeTIFF(buildTIFF(tc.pages...))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(images) != len(tc.expected) {
+				t.Fatalf("Expected %d images, got %d", len(tc.expected), len(images))
+			}
+			for i, img := range images {
+				expected := tc.expected[i]
+				if img.width != expected.width || img.height != expected.height || img.dpiX != expected.dpiX || img.dpiY != expected.dpiY {
+					t.Errorf("Expected page %d to be %dx%d at %vx%v dpi, got %dx%d at %vx%v dpi", i+1,
+						expected.width, expected.height, expected.dpiX, expected.dpiY, img.width, img.height, img.dpiX, img.dpiY)
+				}
+				if img.colorSpace != "/DeviceGray" || img.filter != "/FlateDecode" {
+					t.Errorf("Unexpected image %+v", img)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeTIFFRejects(t *testing.T) {
+	looping := buildTIFF(testTIFFPage{width: 1, height: 1, compression: 1, strip: []byte{1}})
+	// Point the only directory back at itself
+	binary.LittleEndian.PutUint32(looping[8+2+7*12:], 8)
+
+	testCases := []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{name: "Missing header", data: []byte("not a tiff")},
+		{name: "Directory past the end", data: []byte("II*\x00\xff\x00\x00\x00")},
+		{name: "Looping pages", data: looping},
+		{name: "Forged dimensions", data: buildTIFF(testTIFFPage{width: 1 << 20, height: 1 << 20, compression: 1, strip: []byte{1}})},
+		{name: "Missing pixel data", data: buildTIFF(testTIFFPage{width: 3, height: 2, compression: 1, strip: []byte{1}})},
+		{name: "JPEG compression", data: buildTIFF(testTIFFPage{width: 3, height: 2, compression: 7, strip: []byte{0}}), unsupported: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeTIFF(tc.data)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if apperrors.IsUnsupportedFormat(err) != tc.unsupported {
+				t.Errorf("Expected unsupported format %v, got %v", tc.unsupported, err)
+			}
+		})
+	}
+}
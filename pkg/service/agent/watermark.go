@@ -0,0 +1,421 @@
+package agent
+
+import (
+	"context"
+	"encoding/hex"
+	apperrors "file-handler-agent/pkg/error"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watermarkMargin distance in points between an edge anchored stamp and the page edge
+const watermarkMargin = 36
+
+// watermarkChunkSize raw image bytes per PostScript string, strings are capped at 64KiB
+const watermarkChunkSize = 30000
+
+// Largest watermark image accepted, the pixels end up hex encoded in the prelude of every file
+const (
+	maxWatermarkImageSize   = 16 << 20
+	maxWatermarkImagePixels = 1 << 22
+)
+
+// Supported watermark positions
+var watermarkPositions = map[string][2]string{
+	"center":       {"center", "middle"},
+	"top-left":     {"left", "top"},
+	"top":          {"center", "top"},
+	"top-right":    {"right", "top"},
+	"left":         {"left", "middle"},
+	"right":        {"right", "middle"},
+	"bottom-left":  {"left", "bottom"},
+	"bottom":       {"center", "bottom"},
+	"bottom-right": {"right", "bottom"},
+}
+
+// watermarkOptions text or image stamp drawn over selected pages
+type watermarkOptions struct {
+	text       string
+	image      string
+	position   string
+	rotation   float64
+	opacity    float64
+	fontSize   float64
+	color      [3]float64
+	imageWidth float64 // points, 0 for a third of the page width
+	pages      pageSelection
+}
+
+// parseWatermarkOptions read the watermark_* parameters, returning nil when no stamp was requested.
+// Images are picked from the image directory.
+func (g *GhostscriptAgent) parseWatermarkOptions(params map[string]interface{}) (*watermarkOptions, error) {
+	text, _ := params["watermark_text"].(string)
+	imageFile, _ := params["watermark_image"].(string)
+	if text == "" && imageFile == "" {
+		return nil, nil
+	}
+	if text != "" && imageFile != "" {
+		return nil, apperrors.NewInvalidParameterError("watermark_image", "cannot be combined with watermark_text")
+	}
+	if imageFile != "" {
+		if g.ImageDir == "" {
+			return nil, apperrors.NewInvalidParameterError("watermark_image", "no image directory is configured")
+		}
+		path, ok := resolveInDir(g.ImageDir, imageFile)
+		info, err := os.Stat(path)
+		if !ok || err != nil || !info.Mode().IsRegular() {
+			return nil, apperrors.NewInvalidParameterError("watermark_image", fmt.Sprintf("%s is not a file in the image directory", imageFile))
+		}
+		if info.Size() > maxWatermarkImageSize {
+			return nil, apperrors.NewInvalidParameterError("watermark_image", fmt.Sprintf("must be at most %d bytes", maxWatermarkImageSize))
+		}
+		imageFile = path
+	}
+
+	opts := &watermarkOptions{
+		text:     text,
+		image:    imageFile,
+		position: "center",
+		opacity:  0.5,
+		fontSize: 48,
+		color:    [3]float64{1, 0, 0},
+	}
+
+	if position, ok := params["watermark_position"].(string); ok && position != "" {
+		if _, ok := watermarkPositions[position]; !ok {
+			return nil, apperrors.NewInvalidParameterError("watermark_position", fmt.Sprintf("unsupported position %q", position))
+		}
+		opts.position = position
+	}
+
+	if rotation, ok := params["watermark_rotation"].(float64); ok {
+		opts.rotation = rotation
+	}
+
+	if opacity, ok := params["watermark_opacity"].(float64); ok {
+		if opacity <= 0 || opacity > 1 {
+			return nil, apperrors.NewInvalidParameterError("watermark_opacity", "must be greater than 0 and at most 1")
+		}
+		opts.opacity = opacity
+	}
+
+	if fontSize, ok := params["watermark_font_size"].(float64); ok {
+		if fontSize < 1 || fontSize > 1000 {
+			return nil, apperrors.NewInvalidParameterError("watermark_font_size", "must be between 1 and 1000")
+		}
+		opts.fontSize = fontSize
+	}
+
+	if hexColor, ok := params["watermark_color"].(string); ok && hexColor != "" {
+		rgb, err := parseHexColor(hexColor)
+		if err != nil {
+			return nil, apperrors.NewInvalidParameterError("watermark_color", err.Error())
+		}
+		opts.color = rgb
+	}
+
+	if width, ok := params["watermark_width"].(float64); ok {
+		if width <= 0 {
+			return nil, apperrors.NewInvalidParameterError("watermark_width", "must be positive")
+		}
+		opts.imageWidth = width
+	}
+
+	pages, _ := params["watermark_pages"].(string)
+	if pages == "" {
+		pages = "all"
+	}
+	selection, err := parsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+	opts.pages = selection
+
+	return opts, nil
+}
+
+// parseHexColor parse an #RRGGBB color into 0-1 components
+func parseHexColor(s string) ([3]float64, error) {
+	var rgb [3]float64
+	raw, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(raw) != 3 {
+		return rgb, fmt.Errorf("expected #RRGGBB, got %q", s)
+	}
+	for i, c := range raw {
+		rgb[i] = float64(c) / 255
+	}
+	return rgb, nil
+}
+
+// writePrelude write the PostScript defining the stamp to path.
+// Raster devices cannot blend in an EndPage procedure, so for them opacity is
+// approximated by fading the stamp towards white.
+func (w watermarkOptions) writePrelude(path string, raster bool) error {
+	var b strings.Builder
+	b.WriteString("%!\n/FHAWatermark 16 dict def\nFHAWatermark begin\n")
+
+	alignX, alignY := watermarkPositions[w.position][0], watermarkPositions[w.position][1]
+	fade := func(c float64) float64 {
+		if raster {
+			return 1 - w.opacity*(1-c)
+		}
+		return c
+	}
+
+	// Stamp size as /SW and /SH, then the drawing procedure for the stamp centered on the origin
+	var sizeProc, drawProc string
+	if w.image != "" {
+		img, err := loadWatermarkImage(w.image, raster, w.opacity)
+		if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		b.WriteString("/Index 0 def\n/Data [\n")
+		if err := writeImageData(&b, img); err != nil {
+			return err
+		}
+		b.WriteString("] def\n")
+
+		width := "PW 3 div"
+		if w.imageWidth > 0 {
+			width = formatPSNumber(w.imageWidth)
+		}
+		sizeProc = fmt.Sprintf("/SW %s def /SH SW %d mul %d div def", width, bounds.Dy(), bounds.Dx())
+		// White is left transparent so flattened alpha does not blank out the page
+		drawProc = fmt.Sprintf("SW -2 div SH -2 div translate SW SH scale /DeviceRGB setcolorspace /Index 0 def\n"+
+			"<< /ImageType 4 /Width %[1]d /Height %[2]d /BitsPerComponent 8 /Decode [0 1 0 1 0 1]\n"+
+			"   /MaskColor [255 255 255 255 255 255] /ImageMatrix [%[1]d 0 0 %[2]d neg 0 %[2]d]\n"+
+			"   /DataSource { FHAWatermark begin Index Data length lt { Data Index get /Index Index 1 add def } { () } ifelse end }\n"+
+			">> image",
+			bounds.Dx(), bounds.Dy())
+	} else {
+		sizeProc = fmt.Sprintf("/Helvetica-Bold findfont %s scalefont setfont /SW %s stringwidth pop def /SH %s def",
+			formatPSNumber(w.fontSize), psString(w.text), formatPSNumber(w.fontSize))
+		drawProc = fmt.Sprintf("%s %s %s setrgbcolor SW -2 div SH -0.35 mul moveto %s show",
+			formatPSNumber(fade(w.color[0])), formatPSNumber(fade(w.color[1])), formatPSNumber(fade(w.color[2])),
+			psString(w.text))
+	}
+
+	anchorX := map[string]string{
+		"left":   fmt.Sprintf("%d SW 2 div add", watermarkMargin),
+		"center": "PW 2 div",
+		"right":  fmt.Sprintf("PW %d sub SW 2 div sub", watermarkMargin),
+	}[alignX]
+	anchorY := map[string]string{
+		"top":    fmt.Sprintf("PH %d sub SH 2 div sub", watermarkMargin),
+		"middle": "PH 2 div",
+		"bottom": fmt.Sprintf("%d SH 2 div add", watermarkMargin),
+	}[alignY]
+
+	alphaProc := ""
+	if !raster {
+		alphaProc = fmt.Sprintf("/.setfillconstantalpha where { pop %[1]s .setfillconstantalpha } "+
+			"{ /.setopacityalpha where { pop %[1]s .setopacityalpha } if } ifelse", formatPSNumber(w.opacity))
+	}
+
+	fmt.Fprintf(&b, "/Draw {\n  FHAWatermark begin gsave initgraphics\n"+
+		"  currentpagedevice /PageSize get aload pop /PH exch def /PW exch def\n"+
+		"  %s\n  %s\n  %s %s translate %s rotate\n  %s\n  grestore end\n} bind def\nend\n",
+		alphaProc, sizeProc, anchorX, anchorY, formatPSNumber(w.rotation), drawProc)
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// args ghostscript arguments running the prelude and stamping the output pages at the given zero based indexes
+func (w watermarkOptions) args(preludeFile string, pageIndexes []int) []string {
+	var entries []string
+	for _, idx := range pageIndexes {
+		entries = append(entries, strconv.Itoa(idx)+" true")
+	}
+
+	// EndPage gets the number of pages shown so far and the reason, and returns whether to emit the page
+	endPage := fmt.Sprintf("/FHAWatermarkPages << %s >> def "+
+		"<< /EndPage { exch 1 index 2 lt { dup FHAWatermarkPages exch known { FHAWatermark /Draw get exec } if } if pop 2 ne } bind >> setpagedevice",
+		strings.Join(entries, " "))
+
+	return []string{preludeFile, "-c", endPage, "-f"}
+}
+
+// stampIndexes zero based positions within rendered that the selection stamps
+func stampIndexes(rendered []int, stamped []int) []int {
+	selected := make(map[int]bool, len(stamped))
+	for _, page := range stamped {
+		selected[page] = true
+	}
+
+	var indexes []int
+	for i, page := range rendered {
+		if selected[page] {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// loadWatermarkImage decode a JPEG or PNG stamp, flattening alpha onto white and fading it for raster output
+func loadWatermarkImage(path string, raster bool, opacity float64) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Check the dimensions before decoding, a small file can claim a huge image
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, apperrors.NewInvalidParameterError("watermark_image", fmt.Sprintf("cannot decode image: %v", err))
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxWatermarkImagePixels/cfg.Height {
+		return nil, apperrors.NewInvalidParameterError("watermark_image", fmt.Sprintf("%dx%d pixels is too large", cfg.Width, cfg.Height))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, apperrors.NewInvalidParameterError("watermark_image", fmt.Sprintf("cannot decode image: %v", err))
+	}
+
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixel := [3]uint32{r, g, b}
+			var out [3]uint8
+			for i, c := range pixel {
+				// Premultiplied, so compositing onto white adds the uncovered part
+				v := float64(c+(0xffff-a)) / 0xffff
+				if raster {
+					v = 1 - opacity*(1-v)
+				}
+				out[i] = uint8(v*255 + 0.5)
+			}
+			img.SetRGBA(x, y, color.RGBA{R: out[0], G: out[1], B: out[2], A: 0xff})
+		}
+	}
+	return img, nil
+}
+
+// writeImageData write RGB samples as PostScript hex strings of bounded size
+func writeImageData(b *strings.Builder, img *image.RGBA) error {
+	bounds := img.Bounds()
+	samples := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := img.RGBAAt(x, y)
+			samples = append(samples, c.R, c.G, c.B)
+		}
+	}
+	if len(samples) == 0 {
+		return apperrors.NewInvalidParameterError("watermark_image", "image is empty")
+	}
+
+	for start := 0; start < len(samples); start += watermarkChunkSize {
+		chunk := samples[start:min(start+watermarkChunkSize, len(samples))]
+		b.WriteString("<")
+		b.WriteString(hex.EncodeToString(chunk))
+		b.WriteString(">\n")
+	}
+	return nil
+}
+
+// formatPSNumber format a number for PostScript source
+func formatPSNumber(v float64) string {
+	if v == 0 {
+		// Also true for negative zero, which would print as -0
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// watermarkPdf stamp text or an image onto selected pages, writing a pdf per input
+func (g *GhostscriptAgent) watermarkPdf(ctx context.Context, params map[string]interface{}, files []string) ([]string, error) {
+	// Check for context cancellation early
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// Continue with processing
+	}
+
+	startTime := time.Now()
+	log.Printf("Starting PDF watermarking for %d files", len(files))
+
+	if err := validateInputFiles(files); err != nil {
+		return nil, err
+	}
+
+	watermark, err := g.parseWatermarkOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	if watermark == nil {
+		return nil, apperrors.NewInvalidParameterError("watermark_text", "watermark_text or watermark_image is required")
+	}
+
+	colorArgs, err := g.pdfColorArgs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := prepareOutputDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := g.forEachFile(ctx, files, func(file string, _ int) ([]string, error) {
+		fileOutputDir, baseNameWithoutExt, err := makeFileOutputDir(outputDir, file)
+		if err != nil {
+			return nil, err
+		}
+		outputFile := filepath.Join(fileOutputDir, baseNameWithoutExt+".pdf")
+
+		pageCount, err := g.pageCount(ctx, file, passwordFor(params, file))
+		if err != nil {
+			return nil, err
+		}
+		stamped, err := watermark.pages.resolve(pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		preludeFile := filepath.Join(fileOutputDir, baseNameWithoutExt+"_watermark.ps")
+		if err := watermark.writePrelude(preludeFile, false); err != nil {
+			return nil, err
+		}
+		defer os.Remove(preludeFile)
+
+		// Every page is written, so output indexes are page numbers minus one
+		var indexes []int
+		for _, page := range stamped {
+			indexes = append(indexes, page-1)
+		}
+
+		args := append(pdfwriteArgs(outputFile), colorArgs...)
+		args = append(args, watermark.args(preludeFile, indexes)...)
+		args = append(args, inputFileArgs(params, file)...)
+
+		if _, err := g.runGhostscript(ctx, args); err != nil {
+			return nil, err
+		}
+		return []string{outputFile}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Completed PDF watermarking for %d files in %v", len(files), time.Since(startTime))
+
+	return outputFiles, nil
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	apperrors "file-handler-agent/pkg/error"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWatermarkOptions(t *testing.T) {
+	g := &GhostscriptAgent{ImageDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(g.ImageDir, "logo.png"), []byte("not decoded yet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(g.ImageDir, "huge.png"), make([]byte, maxWatermarkImageSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside.png")
+	if err := os.WriteFile(outside, []byte("not decoded yet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		params        map[string]interface{}
+		expectNil     bool
+		expectedParam string
+	}{
+		{name: "No watermark", params: map[string]interface{}{}, expectNil: true},
+		{name: "Text stamp", params: map[string]interface{}{"watermark_text": "DRAFT", "watermark_color": "#00FF00"}},
+		{name: "Bad position", params: map[string]interface{}{"watermark_text": "DRAFT", "watermark_position": "middle-ish"}, expectedParam: "watermark_position"},
+		{name: "Bad opacity", params: map[string]interface{}{"watermark_text": "DRAFT", "watermark_opacity": 1.5}, expectedParam: "watermark_opacity"},
+		{name: "Bad color", params: map[string]interface{}{"watermark_text": "DRAFT", "watermark_color": "red"}, expectedParam: "watermark_color"},
+		{name: "Image stamp", params: map[string]interface{}{"watermark_image": "logo.png"}},
+		{name: "Missing image", params: map[string]interface{}{"watermark_image": "missing.png"}, expectedParam: "watermark_image"},
+		{name: "Server path", params: map[string]interface{}{"watermark_image": outside}, expectedParam: "watermark_image"},
+		{name: "Path escaping the image directory", params: map[string]interface{}{"watermark_image": "../" + filepath.Base(outside)}, expectedParam: "watermark_image"},
+		{name: "Image directory itself", params: map[string]interface{}{"watermark_image": "."}, expectedParam: "watermark_image"},
+		{name: "Oversized image file", params: map[string]interface{}{"watermark_image": "huge.png"}, expectedParam: "watermark_image"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := g.parseWatermarkOptions(tc.params)
+			if tc.expectedParam != "" {
+				name, ok := apperrors.GetParameterFromError(err)
+				if !ok || name != tc.expectedParam {
+					t.Errorf("Expected invalid %s parameter error, got %v", tc.expectedParam, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.expectNil != (opts == nil) {
+				t.Errorf("Expected nil options %v, got %+v", tc.expectNil, opts)
+			}
+		})
+	}
+}
+
+func TestWatermarkPrelude(t *testing.T) {
+	opts, err := (&GhostscriptAgent{}).parseWatermarkOptions(map[string]interface{}{
+		"watermark_text":    "CONFIDENTIAL (copy)",
+		"watermark_opacity": 0.5,
+		"watermark_color":   "#000000",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "prelude.ps")
+	if err := opts.writePrelude(path, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prelude, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(prelude), `(CONFIDENTIAL \(copy\))`) {
+		t.Errorf("Expected escaped stamp text in prelude:\n%s", prelude)
+	}
+	// Raster output fades black to mid gray instead of blending
+	if !strings.Contains(string(prelude), "0.5 0.5 0.5 setrgbcolor") {
+		t.Errorf("Expected faded color in prelude:\n%s", prelude)
+	}
+}
+
+func TestStampIndexes(t *testing.T) {
+	indexes := stampIndexes([]int{2, 4, 6, 8}, []int{1, 2, 3, 8})
+	if !reflect.DeepEqual(indexes, []int{0, 3}) {
+		t.Errorf("Expected indexes [0 3], got %v", indexes)
+	}
+}
+
+func TestLoadWatermarkImageTooLarge(t *testing.T) {
+	// Only the header is read, so a forged size is refused without allocating the pixels
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	forged := buf.Bytes()
+	binary.BigEndian.PutUint32(forged[16:], 1<<15)
+	binary.BigEndian.PutUint32(forged[20:], 1<<15)
+	binary.BigEndian.PutUint32(forged[29:], crc32.ChecksumIEEE(forged[12:29]))
+	path := filepath.Join(t.TempDir(), "forged.png")
+	if err := os.WriteFile(path, forged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadWatermarkImage(path, false, 1)
+	if name, ok := apperrors.GetParameterFromError(err); !ok || name != "watermark_image" {
+		t.Errorf("Expected invalid watermark_image parameter error, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected the size to be refused, got %v", err)
+	}
+}
@@ -118,8 +118,8 @@ func (s *fileHandlerService) ProcessFile(ctx context.Context, req FileRequest) (
 	}
 
 	// Add any metadata information
-	var metadata []string
-	if metaInfo, ok := req.Parameters["metadata"].([]string); ok {
+	var metadata []interface{}
+	if metaInfo, ok := req.Parameters["metadata"].([]interface{}); ok {
 		metadata = metaInfo
 	}
 
@@ -62,8 +62,8 @@ func TestProcessFile(t *testing.T) {
 				if !resp.Success {
 					t.Error("Expected success to be true")
 				}
-				if len(resp.Files) != len(tc.expectedFiles) {
-					t.Errorf("Expected %d files, got %d", len(tc.expectedFiles), len(resp.Files))
+				if len(resp.Message.Result.OutputFiles) != len(tc.expectedFiles) {
+					t.Errorf("Expected %d files, got %d", len(tc.expectedFiles), len(resp.Message.Result.OutputFiles))
 				}
 			}
 
@@ -73,3 +73,34 @@ func TestProcessFile(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessFileMetadata(t *testing.T) {
+	mockAgent := &MockAgent{
+		ExecuteFn: func(ctx context.Context, action string, params map[string]interface{}, files []string) ([]string, error) {
+			params["metadata"] = []interface{}{map[string]interface{}{"file": files[0], "page_count": 3}}
+			return []string{"output1.pdf"}, nil
+		},
+	}
+
+	registry := agent.NewRegistry()
+	registry.Register("mock", mockAgent)
+
+	svc := NewFileHandlerService(registry)
+
+	resp, err := svc.ProcessFile(context.Background(), FileRequest{
+		Agent:  "mock",
+		Action: "testAction",
+		Files:  []string{"file1.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(resp.Message.Result.MetaData) != 1 {
+		t.Fatalf("Expected 1 metadata entry, got %d", len(resp.Message.Result.MetaData))
+	}
+	entry, ok := resp.Message.Result.MetaData[0].(map[string]interface{})
+	if !ok || entry["file"] != "file1.pdf" {
+		t.Errorf("Unexpected metadata entry: %v", resp.Message.Result.MetaData[0])
+	}
+}
@@ -19,10 +19,10 @@ type Message struct {
 }
 
 type Result struct {
-	OutputFiles        []string `json:"output_files"`
-	RawProcessorOutput string   `json:"raw_processor_output"`
-	MetaData           []string `json:"metadata"`
-	ProcessingTime     string   `json:"processing_time"`
+	OutputFiles        []string      `json:"output_files"`
+	RawProcessorOutput string        `json:"raw_processor_output"`
+	MetaData           []interface{} `json:"metadata"`
+	ProcessingTime     string        `json:"processing_time"`
 }
 
 // FileResponse struct file response data